@@ -0,0 +1,48 @@
+package json
+
+import "sync"
+
+// UnmarshalBatch validates and decodes each of inputs, as UnmarshalX would
+// with opts, using up to concurrency goroutines. Each input is decoded into a
+// new value from newElem, which is only ever called from the calling
+// goroutine so it needn't be safe for concurrent use. The returned errors
+// correspond to inputs by index, nil for each input that was decoded. The
+// options are compiled once and shared by every worker; a ConfigError is
+// returned instead if they are invalid.
+func UnmarshalBatch(inputs [][]byte, newElem func() interface{}, opts *Options, concurrency int) ([]error, error) {
+	var c *CompiledOptions
+	if opts != nil {
+		var err error
+		if c, err = Compile(*opts); err != nil {
+			return nil, err
+		}
+	}
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	type job struct {
+		i int
+		v interface{}
+	}
+	jobs := make(chan job)
+	errs := make([]error, len(inputs))
+
+	var wg sync.WaitGroup
+	for w := 0; w < concurrency && w < len(inputs); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range jobs {
+				errs[j.i] = UnmarshalCompiled(inputs[j.i], j.v, c)
+			}
+		}()
+	}
+
+	for i := range inputs {
+		jobs <- job{i, newElem()}
+	}
+	close(jobs)
+	wg.Wait()
+	return errs, nil
+}
@@ -0,0 +1,46 @@
+package json
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestUnmarshalBatch(t *testing.T) {
+	var inputs [][]byte
+	for i := 0; i < 50; i++ {
+		if i%3 == 0 {
+			inputs = append(inputs, []byte(fmt.Sprintf(`{"bar": %d}`, i)))
+		} else {
+			inputs = append(inputs, []byte(fmt.Sprintf(`{"foo": "f%d", "bar": %d}`, i, i)))
+		}
+	}
+
+	var elems []*TestStruct
+	newElem := func() interface{} {
+		elems = append(elems, &TestStruct{})
+		return elems[len(elems)-1]
+	}
+	errs, err := UnmarshalBatch(inputs, newElem, &Options{Required: []string{"foo"}}, 4)
+	noErr(t, err)
+
+	if len(errs) != len(inputs) || len(elems) != len(inputs) {
+		t.Fatalf("got: %d errors and %d values, want: %d of each", len(errs), len(elems), len(inputs))
+	}
+	for i, e := range errs {
+		if i%3 == 0 {
+			testErrors(t, e, NewMissingKeyError("/foo"))
+			continue
+		}
+		noErr(t, e)
+		if want := fmt.Sprintf("f%d", i); elems[i].Foo != want || *elems[i].Bar != i {
+			t.Errorf("%d: got: %+v, want: foo %s and bar %d", i, elems[i], want, i)
+		}
+	}
+}
+
+func TestUnmarshalBatchConfigError(t *testing.T) {
+	opts := &Options{Required: []string{"a"}, Forbidden: []string{"a"}}
+	if _, err := UnmarshalBatch([][]byte{[]byte(`{}`)}, func() interface{} { return &TestStruct{} }, opts, 2); !isConfigError(err) {
+		t.Errorf("got: %v, want: ConfigError", err)
+	}
+}
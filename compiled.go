@@ -0,0 +1,54 @@
+package json
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"sync"
+)
+
+// CompiledOptions holds Options prepared for validation, such as their key
+// sets and compiled patterns, so that the work isn't repeated by each call.
+// It is safe for concurrent use.
+type CompiledOptions struct {
+	bo builtOptions
+
+	// byType caches the state derived from each destination type for the
+	// options which depend on it.
+	byType sync.Map
+}
+
+// Compile prepares o for use with UnmarshalCompiled. It returns a ConfigError
+// if o is invalid, as UnmarshalX would.
+func Compile(o Options) (*CompiledOptions, error) {
+	bo, err := compileOptions(o)
+	if err != nil {
+		return nil, err
+	}
+	return &CompiledOptions{bo: bo}, nil
+}
+
+// UnmarshalCompiled behaves as UnmarshalX with the Options c was compiled
+// from. Passing c as nil behaves as json.Unmarshal.
+func UnmarshalCompiled(data []byte, v interface{}, c *CompiledOptions) error {
+	if c == nil {
+		return json.Unmarshal(data, v)
+	}
+	_, err := unmarshalBuilt(context.Background(), data, v, c.forValue(v))
+	return err
+}
+
+// forValue returns the compiled options completed for the destination v.
+func (c *CompiledOptions) forValue(v interface{}) builtOptions {
+	if !c.bo.dependsOnValue() || v == nil {
+		return c.bo
+	}
+
+	t := reflect.TypeOf(v)
+	if bo, ok := c.byType.Load(t); ok {
+		return bo.(builtOptions)
+	}
+	bo := c.bo.forValue(v)
+	c.byType.Store(t, bo)
+	return bo
+}
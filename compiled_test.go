@@ -0,0 +1,58 @@
+package json
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestUnmarshalCompiled(t *testing.T) {
+	c, err := Compile(Options{Required: []string{"foo"}, NullNotPresent: []string{"foo"}, Pattern: map[string]string{"foo": "^a"}})
+	noErr(t, err)
+
+	var o TestStruct
+	noErr(t, UnmarshalCompiled([]byte(`{"foo": "abc"}`), &o, c))
+	if o.Foo != "abc" {
+		t.Errorf("got: %q, want: abc", o.Foo)
+	}
+	testErrors(t, UnmarshalCompiled([]byte(`{"bar": 1}`), &o, c), NewMissingKeyError("/foo"))
+	testErrors(t, UnmarshalCompiled([]byte(`{"foo": "b"}`), &o, c),
+		NewValidationError(PatternMismatch, "/foo", "does not match ^a"))
+
+	noErr(t, UnmarshalCompiled([]byte(`{"foo": null}`), &o, nil))
+}
+
+func TestCompileConfigError(t *testing.T) {
+	if _, err := Compile(Options{Required: []string{"a"}, Forbidden: []string{"a"}}); !isConfigError(err) {
+		t.Errorf("got: %v, want: ConfigError", err)
+	}
+}
+
+func TestUnmarshalCompiledPerType(t *testing.T) {
+	c, err := Compile(Options{Pedantic: true})
+	noErr(t, err)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			testErrors(t, UnmarshalCompiled([]byte(`{"foo": "a"}`), &TestStruct{}, c), NewMissingKeyError("/bar"))
+			testErrors(t, UnmarshalCompiled([]byte(`{"id": "1", "name": "n"}`), &strictStruct{}, c), NewMissingKeyError("/Plain"))
+		}()
+	}
+	wg.Wait()
+}
+
+func BenchmarkUnmarshalCompiled(b *testing.B) {
+	c, err := Compile(Options{Required: []string{"key_number_1"}, NullNotPresent: []string{"key_number_1"}})
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		var o struct{}
+		if err := UnmarshalCompiled(manyKeys, &o, c); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
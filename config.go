@@ -0,0 +1,52 @@
+package json
+
+import (
+	"bytes"
+	"encoding/json"
+	"sync/atomic"
+)
+
+// Config holds package-wide settings for the functions which pass through to
+// encoding/json, as opposed to Options which apply to a single call. The zero
+// Config behaves as encoding/json does.
+type Config struct {
+	// DisableHTMLEscape stops Marshal, MarshalIndent, and MarshalX from
+	// escaping <, >, and & in strings as \u003c, \u003e, and \u0026.
+	DisableHTMLEscape bool
+}
+
+// config holds the Config set by SetConfig.
+var config atomic.Value
+
+// SetConfig replaces the package-wide Config. It is safe to call concurrently
+// with the functions it affects, which see either the old or the new Config.
+func SetConfig(c Config) {
+	config.Store(c)
+}
+
+// CurrentConfig returns the package-wide Config last passed to SetConfig.
+func CurrentConfig() Config {
+	c, _ := config.Load().(Config)
+	return c
+}
+
+// marshal encodes v as json.MarshalIndent would, or as json.Marshal if indent
+// and prefix are empty, honoring the package-wide Config.
+func marshal(v interface{}, prefix, indent string) ([]byte, error) {
+	if !CurrentConfig().DisableHTMLEscape {
+		if prefix == "" && indent == "" {
+			return json.Marshal(v)
+		}
+		return json.MarshalIndent(v, prefix, indent)
+	}
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent(prefix, indent)
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	// Encode terminates each value with a newline which Marshal doesn't
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
+}
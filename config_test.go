@@ -0,0 +1,50 @@
+package json
+
+import "testing"
+
+func TestConfigDisableHTMLEscape(t *testing.T) {
+	defer SetConfig(CurrentConfig())
+	v := map[string]string{"html": "<a href=\"x\">&</a>"}
+
+	got, err := Marshal(v)
+	noErr(t, err)
+	if want := `{"html":"\u003ca href=\"x\"\u003e\u0026\u003c/a\u003e"}`; string(got) != want {
+		t.Errorf("got: %s, want: %s", got, want)
+	}
+
+	SetConfig(Config{DisableHTMLEscape: true})
+	got, err = Marshal(v)
+	noErr(t, err)
+	if want := `{"html":"<a href=\"x\">&</a>"}`; string(got) != want {
+		t.Errorf("got: %s, want: %s", got, want)
+	}
+
+	got, err = MarshalIndent(v, "", "  ")
+	noErr(t, err)
+	if want := "{\n  \"html\": \"<a href=\\\"x\\\">&</a>\"\n}"; string(got) != want {
+		t.Errorf("got: %s, want: %s", got, want)
+	}
+
+	if _, err := Marshal(func() {}); err == nil {
+		t.Errorf("got: no error, want: an unsupported type error")
+	}
+}
+
+func TestConfigMarshalX(t *testing.T) {
+	defer SetConfig(CurrentConfig())
+	v := map[string]string{"html": "<b>"}
+
+	SetConfig(Config{DisableHTMLEscape: true})
+	got, err := MarshalX(v, &Options{Required: []string{"html"}})
+	noErr(t, err)
+	if want := `{"html":"<b>"}`; string(got) != want {
+		t.Errorf("got: %s, want: %s", got, want)
+	}
+
+	SetConfig(Config{})
+	got, err = MarshalX(v, nil)
+	noErr(t, err)
+	if want := `{"html":"\u003cb\u003e"}`; string(got) != want {
+		t.Errorf("got: %s, want: %s", got, want)
+	}
+}
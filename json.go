@@ -15,9 +15,19 @@ package json
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"math"
+	"math/big"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
 	"strings"
+	"sync/atomic"
+	"unicode/utf8"
 )
 
 type Options struct {
@@ -26,125 +36,2795 @@ type Options struct {
 	// Pedantic is set it does not impact how null is treated, that is still
 	// driven through GlobalNullNotPresent or NullNotPresent.
 	//
-	// Currently unsupported. :(
-	Pedantic bool // TODO
+	// Unspecified keys are reported as UnknownKey errors, as with Strict, and
+	// the fields are required by their json names in addition to any keys in
+	// Required. Fields listed in Forbidden are left forbidden rather than
+	// required. Pedantic has no effect if the destination isn't a struct.
+	Pedantic bool
 
 	// Strict will treat any key that not specified in the destination struct as
-	// a forbidden key.
+	// an UnknownKey error. Keys are matched against the struct's json field
+	// names, including those promoted from embedded structs, case-insensitively
+	// as encoding/json does. Keys starting with MetaKeyPrefix are exempt. Strict
+	// has no effect if the destination isn't a struct.
+	Strict bool
+
+	// CollapseUnknownKeys reports the keys of each object that Strict rejects
+	// as a single UnknownKey error, located at the object, whose Key lists all
+	// of them separated by commas, rather than one error per key. It has no
+	// effect on keys left to UnknownFieldHandler.
+	CollapseUnknownKeys bool
+
+	// UnknownFieldHandler, if set, decides what to do with each key that isn't
+	// a field of the destination struct, in place of Strict's UnknownKey error.
+	// Returning nil tolerates the key. A returned ValidationError is reported
+	// as is, and any other error as an UnknownKey error with the error as its
+	// Detail. raw may alias the input so it must be copied to be retained. The
+	// handler is not called if the destination isn't a struct.
+	UnknownFieldHandler func(key string, raw json.RawMessage) error
+
+	// ReportUnknownKeys lists the keys that Strict would reject in the
+	// ValidationResult's UnknownKeys without failing the unmarshal, so that
+	// the keys clients send can be audited before Strict is turned on.
+	ReportUnknownKeys bool
+
+	// GlobalNullNotPresent will force UnmarshalX to act as if NullNotPresent is
+	// set for every key.
+	GlobalNullNotPresent bool
+
+	// FailFast will abort unmarshalling on the first encountered error.
+	FailFast bool
+
+	// MaxErrors stops validation once that many errors have been found,
+	// bounding the work and the size of the ErrorCollection for input that
+	// breaks many rules at once. The collection is then marked as Truncated.
+	// Zero means no limit.
+	MaxErrors int
+
+	// ApplyRecursively enforces the rules on an object's keys, such as Required
+	// and Forbidden, on every object in the document rather than only the
+	// top-level one. Objects nested inside arrays are checked as well.
+	//
+	// The document is traversed depth first: an object's own keys are checked
+	// before any of its children are visited, children are visited in sorted
+	// key order, and array elements in index order. FailFast stops the whole
+	// traversal at the first error, wherever it occurs.
+	ApplyRecursively bool
+
+	// StripNulls removes every key whose value is null before the final decode
+	// into the destination, leaving the corresponding fields untouched. If
+	// ApplyRecursively is set nulls are stripped from nested objects as well.
+	StripNulls bool
+
+	// Defaults maps optional top-level keys to the value to decode in their
+	// place when they are absent, or null and treated as absent through
+	// NullNotPresent. A value in the input always wins. Defaults are added
+	// once validation has passed, so they aren't themselves validated, and a
+	// key may not be both defaulted and required or forbidden. For an array
+	// the defaults are added to each element.
+	Defaults map[string]json.RawMessage
+
+	// MaxItemsDeep caps the number of elements of every array in the document,
+	// however deeply it is nested. Zero means no limit.
+	MaxItemsDeep int
+
+	// MaxItemsBeforeDecode caps the number of elements of the arrays held at
+	// keys. Elements are counted by skimming the input, stopping once the cap
+	// is passed, so an oversized array is a LengthViolation error before any
+	// of it is decoded into the destination. Values other than arrays are
+	// ignored.
+	MaxItemsBeforeDecode map[string]int
+
+	// RejectUndefinedString rejects any string value, however deeply nested,
+	// that is exactly "undefined"; a common artifact of javascript clients
+	// serializing an undefined variable.
+	RejectUndefinedString bool
+
+	// VerifyRoundTrip re-marshals the destination after decoding and reports a
+	// RoundTripMismatch error if it differs from the input, after any rewriting
+	// such as StripNulls, when both are compared canonically. This catches
+	// input the destination silently drops, such as keys with no matching
+	// field. Only the keys present in the input are compared, so fields the
+	// input didn't set don't count as a mismatch.
+	VerifyRoundTrip bool
+
+	// RejectDuplicateKeys reports a DuplicateKey error for each key that
+	// appears more than once in an object, however deeply nested, rather than
+	// letting the last value win as encoding/json does. This requires
+	// walking every token of the input.
+	RejectDuplicateKeys bool
+
+	// ForbidCaseInsensitiveDuplicateKeys reports a DuplicateKey error for each
+	// key in an object that differs only in case from an earlier key, such as
+	// host following Host, since encoding/json may decode either into the same
+	// struct field. Keys repeated exactly are left to RejectDuplicateKeys.
+	ForbidCaseInsensitiveDuplicateKeys bool
+
+	// RejectNaNFields checks the destination once it has been decoded and
+	// reports a NonFiniteNumber error for any float field holding NaN or an
+	// infinity, which a custom Decode could otherwise let through.
+	RejectNaNFields bool
+
+	// Canonicalize re-encodes the document in canonical form, with sorted keys
+	// and no insignificant whitespace, once it has been validated. The
+	// destination is decoded from the canonical form, which is also exposed
+	// through ValidationResult.Canonical for hashing or signing.
+	Canonicalize bool
+
+	// ExpectedKeys is a hint of how many keys the top-level object holds, used
+	// to size the map it is decoded into and avoid growing it for large
+	// objects. Zero leaves the map to grow as needed.
+	ExpectedKeys int
+
+	// InternKeys shares the strings used for object keys between calls, which
+	// reduces allocations when decoding many documents with the same keys.
+	InternKeys bool
+
+	// NullNotPresent is a set of keys that will treat null as an unset value.
+	// The default behavior is that `"key": null` will satisfy key presence for
+	// the Required keys. For keys contained in this set an error would be thrown
+	// instead.
+	NullNotPresent []string
+
+	// DistinguishAbsentFromNull reports a required key which is set to null,
+	// but treated as absent through NullNotPresent or GlobalNullNotPresent, as
+	// a NullNotAllowed error rather than a MissingKey one. Keys which are truly
+	// absent are still reported as MissingKey.
+	DistinguishAbsentFromNull bool
+
+	// Required is a set of keys that must be set in the json being unmarshalled.
+	// Any Unmarshal of json containing these keys will return an error if they
+	// are not present.
 	//
-	// Currently unsupported. :(
-	Strict bool // TODO
+	// Keys in Required, Forbidden, and NullNotPresent may refer to nested keys
+	// with a dotted path such as "server.host", unless the object holds a key
+	// by that literal name. Errors for such keys carry the dotted path as their
+	// Key.
+	Required []string
+
+	// Forbidden specifies a set of keys that must *not* be set in the json being
+	// unmarshalled. If they are present they will result in an error. A key
+	// set to null is present for this purpose, regardless of NullNotPresent.
+	Forbidden []string
+
+	// RequiredSet and ForbiddenSet hold further keys for Required and
+	// Forbidden, for options built up with a KeySet. A nil set adds nothing.
+	RequiredSet  *KeySet
+	ForbiddenSet *KeySet
+
+	// CaptureForbiddenValues records the value of each forbidden key that was
+	// set in its error's Value field. It is off by default to avoid leaking
+	// data into logs.
+	CaptureForbiddenValues bool
+
+	// RedactKeys lists keys whose values are never captured. Their Value is
+	// replaced with the string "[redacted]".
+	RedactKeys []string
+
+	// FieldEquals is a set of key pairs which must hold the same value, such as
+	// a password and its confirmation. Values are compared after decoding so
+	// that formatting differences such as whitespace are ignored. A pair is
+	// skipped if either of its keys is absent.
+	FieldEquals [][2]string
+
+	// Enum restricts the values held at keys, when present, to a set such as
+	// "dev", "staging", and "prod". Strings are compared by their contents and
+	// other scalars by their json text, so 1, true, and null may be listed too.
+	// A value outside the set is a NotInEnum error listing the set.
+	Enum map[string][]string
+
+	// EnumCaseInsensitive compares strings against the members of Enum and
+	// EnumWhen ignoring case, so that "US" matches "us".
+	EnumCaseInsensitive bool
+
+	// EnumWhen restricts the values a key may hold depending on the value of
+	// another key, such as the valid subtypes for each type.
+	EnumWhen []ConditionalEnum
+
+	// RequiredIf makes keys required depending on the value of another key,
+	// such as a certificate and key being required when tls is true. Keys
+	// which become required are reported as for Required.
+	RequiredIf []ConditionalRequirement
+
+	// AllowedNumbers restricts the numbers held at keys, when present, to a
+	// discrete set such as the retry counts 1, 3, and 5. Numbers are compared
+	// within a small relative tolerance so that 0.3 matches 0.1+0.2. A number
+	// outside the set is an InvalidEnum error and any other value is a
+	// TypeMismatch; as with Min null only fails if it isn't treated as present.
+	AllowedNumbers map[string][]float64
+
+	// RequiredPaths is a set of paths, given as their segments, to values that
+	// must be present within nested objects, e.g. {"server", "host"}. A
+	// segment holding an integer indexes into an array, so {"items", "0",
+	// "id"} requires the first element of items to have an id.
+	RequiredPaths [][]string
+
+	// KeyOrder lists keys which, when present in the top-level object, must
+	// appear in the input in the given relative order. Only the first key out
+	// of order is reported. This is checked against the raw input so it
+	// requires scanning the document once more.
+	KeyOrder []string
+
+	// RequiredPositive is a set of keys that must be present and hold a number
+	// greater than zero.
+	RequiredPositive []string
+
+	// RequiredNonEmpty is a set of keys that must be present and hold something
+	// meaningful: null, "", [], and {} are reported as MissingKey errors with
+	// the Detail "empty", regardless of NullNotPresent. Keys may be dotted
+	// paths as for Required.
+	RequiredNonEmpty []string
+
+	// WholeNumber is a set of keys that, when present, must hold a number with
+	// no fractional part. Unlike an integer check 2.0 is accepted.
+	WholeNumber []string
+
+	// RejectScientificNotation is a set of keys whose numbers, when present,
+	// may not be written with an exponent such as 1e3, for consumers that
+	// can't parse them. Such a number is an InvalidNumber error.
+	RejectScientificNotation []string
+
+	// GlobalRejectScientificNotation acts as if RejectScientificNotation listed
+	// every key.
+	GlobalRejectScientificNotation bool
+
+	// Types maps keys to the json type their value must have when present: one
+	// of "string", "number", "boolean", "object", or "array". A null value is
+	// only a mismatch if null is not treated as present for the key, as with
+	// NullNotPresent.
+	Types map[string]string
+
+	// Min and Max bound the numbers held at keys, inclusively, such as a port
+	// being between 1 and 65535. A value outside its bounds is an OutOfRange
+	// error and a value that isn't a number is a TypeMismatch. As with Types a
+	// null value only fails if null is not treated as present for the key.
+	// Numbers are compared exactly, even those too long to fit a float64. If
+	// the key is decoded into an integer field of a struct, such as a
+	// time.Duration, a number outside the range of the field's type is also
+	// OutOfRange rather than overflowing it.
+	Min map[string]float64
+	Max map[string]float64
+
+	// MinLength and MaxLength bound the length of the strings held at keys,
+	// inclusively, counted as LengthMode selects. A string outside its bounds
+	// is a LengthViolation error and any other value is a TypeMismatch. As
+	// with Types null only fails if it isn't treated as present.
+	MinLength map[string]int
+	MaxLength map[string]int
+
+	// LengthMode selects how MinLength and MaxLength count a string's length:
+	// in characters (Runes), the default, or in utf-8 encoded bytes (Bytes),
+	// such as for a column with a limit on its size in bytes.
+	LengthMode LengthMode
+
+	// Pattern maps keys to a regular expression that a string held at the key
+	// must match, such as a rough check for an email address. A string which
+	// doesn't match is a PatternMismatch error and any other value is a
+	// TypeMismatch. As with Types null only fails if it isn't treated as present.
+	Pattern map[string]string
+
+	// PatternAnyOf maps keys to regular expressions of which a string held at
+	// the key must match at least one, such as several accepted ID formats. A
+	// string matching none is a PatternMismatch error and any other value is a
+	// TypeMismatch. As with Types null only fails if it isn't treated as present.
+	PatternAnyOf map[string][]string
+
+	// MaxPatternInputBytes bounds the length in bytes of the strings checked
+	// against Pattern and PatternAnyOf, so that huge inputs can't make the
+	// checks expensive. A longer string is a PatternMismatch error without
+	// being matched. Zero means no limit.
+	MaxPatternInputBytes int
+
+	// HomogeneousArrays is a set of keys that, when they hold an array, must
+	// only contain elements of a single json type. null is a type of its own so
+	// an array mixing null and strings is rejected.
+	HomogeneousArrays []string
+
+	// FieldOptions holds Options for the objects held at particular keys. They
+	// are only enforced when the key is present and holds an object, so an
+	// optional object may still have required keys of its own. A nil entry
+	// places no rules on its key.
+	FieldOptions map[string]*Options
+
+	// AtLeastNOf is a set of key groups where at least N of each group's keys
+	// must be present.
+	AtLeastNOf []KeyGroup
+
+	// MutuallyExclusive is a set of key groups of which at most one key each
+	// may be present, such as an inline certificate and a certificate file.
+	// Setting more than one is a ConflictingKeys error.
+	MutuallyExclusive [][]string
+
+	// ExactlyOneOf is as MutuallyExclusive but one key of each group must also
+	// be present; a group with none is a MissingGroup error.
+	ExactlyOneOf [][]string
+
+	// AtLeastOne is a set of key groups of which at least one key each must be
+	// present, such as the credentials a client may authenticate with. A group
+	// with none is a MissingGroup error.
+	AtLeastOne [][]string
+
+	// Aliases maps a key to alternative names it may be sent under. An alias is
+	// renamed to its key before validation and decoding. If the key itself is
+	// present it takes precedence and its aliases are dropped; otherwise the
+	// first alias present, in the order listed, is used.
+	Aliases map[string][]string
+
+	// ForbidAliasCollision reports an AliasCollision error for each alias that
+	// is dropped because its key, or an earlier alias, is also present.
+	ForbidAliasCollision bool
+
+	// AllowEmptyInput accepts empty input, leaving the destination untouched,
+	// provided it satisfies the other options. Otherwise empty input results in
+	// an EmptyInput error unless another error, such as a missing Required
+	// key, is reported first.
+	AllowEmptyInput bool
+
+	// RequireContiguousIndices checks objects whose keys are all integers, such
+	// as {"0": .., "2": ..}, and reports a MissingKey error for each index
+	// missing from the range 0 through the largest key. A run of more than 16
+	// missing indices is reported as one error at its first index, whose
+	// Detail gives the last.
+	RequireContiguousIndices bool
+
+	// KeyPattern is a regular expression that every key must match, such as
+	// `^[a-z][a-z0-9_]*$` to enforce snake_case names.
+	KeyPattern string
+
+	// WarnOnly runs every configured check but never fails the decode because
+	// of them. Findings are reported as warnings through UnmarshalWithResult,
+	// which lets stricter rules be observed before they are enforced.
+	WarnOnly bool
+
+	// KeysEnum restricts an object's keys to a fixed vocabulary; any other key
+	// results in an InvalidKey error. Unlike Strict it doesn't depend on the
+	// destination, making it useful for maps.
+	KeysEnum []string
+
+	// MetaKeyPrefix marks keys starting with the prefix, such as "@" for
+	// attributes of json converted from XML, as metadata. Metadata keys are
+	// exempt from the checks on key names: KeyPattern, KeysEnum,
+	// RequireContiguousIndices, and Strict.
+	MetaKeyPrefix string
+
+	// MaxDistinctErrorKeys caps the number of distinct keys that errors are
+	// reported for, where a key nested in different objects, such as "y" in
+	// /a/y and /b/y, counts once. Errors for any further keys are collapsed
+	// into a single SuppressedErrors error. Zero means no limit.
+	MaxDistinctErrorKeys int
+
+	// Decode performs the final decode into the destination once validation
+	// has passed. It defaults to json.Unmarshal and may be set to use an
+	// alternative json library.
+	Decode func(data []byte, v interface{}) error
+
+	// OnSuccess is called with the destination once it has been decoded and
+	// validation has passed, such as to fill in defaults or derived fields. It
+	// isn't called if any error is returned.
+	OnSuccess func(v interface{})
+
+	// DisallowUnknownFields rejects keys which don't match a field of the
+	// struct they would be decoded into, however deeply nested, as
+	// json.Decoder.DisallowUnknownFields does. Once validation has passed the
+	// first such key is reported as an UnknownKey error located at the key,
+	// before the final decode is made with Decode. With WarnOnly it is
+	// reported as a warning and the decode goes ahead.
+	DisallowUnknownFields bool
+
+	// RequireNonEmptyOnMarshal lists the keys, by their json names, of the
+	// fields or map entries of the value given to MarshalX which must hold a
+	// value other than their zero value, or for strings, slices, and maps a
+	// non-empty one. A key which doesn't is a MissingKey error and nothing is
+	// encoded. UnmarshalX ignores it.
+	RequireNonEmptyOnMarshal []string
+}
+
+// ConditionalEnum requires that, when Trigger holds TriggerValue, Key is either
+// absent or holds one of the values in Allowed, compared as for Enum.
+// TriggerValue is compared by its decoded form so formatting differences don't
+// matter.
+type ConditionalEnum struct {
+	Trigger      string
+	TriggerValue json.RawMessage
+	Key          string
+	Allowed      []string
+}
+
+// LengthMode is a way of counting the length of a string.
+type LengthMode int
+
+const (
+	Runes LengthMode = iota
+	Bytes
+)
+
+// length returns the length of s counted as m selects.
+func (m LengthMode) length(s string) int {
+	if m == Bytes {
+		return len(s)
+	}
+	return utf8.RuneCountInString(s)
+}
+
+// unit names the unit lengths are counted in for error details. Runes, the
+// default, are left unnamed.
+func (m LengthMode) unit() string {
+	if m == Bytes {
+		return " bytes"
+	}
+	return ""
+}
+
+// ConditionalRequirement requires each of Keys, when Trigger holds
+// TriggerValue, as if they were listed in Required. TriggerValue is compared by
+// its decoded form as for ConditionalEnum.
+type ConditionalRequirement struct {
+	Trigger      string
+	TriggerValue json.RawMessage
+	Keys         []string
+}
+
+// KeyGroup is a set of keys of which at least N must be present.
+type KeyGroup struct {
+	Keys []string
+	N    int
+}
+
+type builtOptions struct {
+	Options
+	nullNotPresentSet map[string]bool
+	keysEnumSet       map[string]bool
+	forbiddenSet      map[string]bool
+	redactSet         map[string]bool
+	keyPattern        *regexp.Regexp
+	fieldOptions      map[string]builtOptions
+	pattern           map[string]*regexp.Regexp
+	patterns          map[string][]*regexp.Regexp
+
+	// presenceOnly is set when the options only depend on which top-level keys
+	// are present, and not on their values.
+	presenceOnly bool
+
+	// structKeys holds the lowercased json names of the destination's fields
+	// when unknown keys are checked, or nil if the destination isn't a struct.
+	structKeys map[string]bool
+
+	// intFields holds the types of the destination's integer fields, such as
+	// time.Duration, by the Min or Max key they are decoded from.
+	intFields map[string]reflect.Type
+
+	// rulesPerObject approximates the validation budget spent checking the
+	// rules against a single object, aside from visiting its keys.
+	rulesPerObject int
+}
+
+func prepareOptions(o Options, v interface{}) (builtOptions, error) {
+	bo, err := compileOptions(o)
+	if err != nil {
+		return bo, err
+	}
+	return bo.forValue(v), nil
+}
+
+// compileOptions builds the internal state for o which doesn't depend on the
+// destination.
+func compileOptions(o Options) (builtOptions, error) {
+	if o.RequiredSet != nil || o.ForbiddenSet != nil {
+		o.Required = appendNew(o.Required[:len(o.Required):len(o.Required)], o.RequiredSet.Slice())
+		o.Forbidden = appendNew(o.Forbidden[:len(o.Forbidden):len(o.Forbidden)], o.ForbiddenSet.Slice())
+		o.RequiredSet, o.ForbiddenSet = nil, nil
+	}
+	bo := builtOptions{Options: o, nullNotPresentSet: map[string]bool{}, presenceOnly: presenceOnly(o)}
+	for _, k := range bo.NullNotPresent {
+		bo.nullNotPresentSet[k] = true
+	}
+
+	if len(bo.KeysEnum) != 0 {
+		bo.keysEnumSet = map[string]bool{}
+		for _, k := range bo.KeysEnum {
+			bo.keysEnumSet[k] = true
+		}
+	}
+
+	for k, t := range bo.Types {
+		if !jsonKinds[t] {
+			return bo, ConfigError{fmt.Sprintf("Types: key <%s> has unknown type %q", k, t)}
+		}
+	}
+
+	if len(bo.RedactKeys) != 0 {
+		bo.redactSet = map[string]bool{}
+		for _, k := range bo.RedactKeys {
+			bo.redactSet[k] = true
+		}
+	}
+
+	bo.forbiddenSet = map[string]bool{}
+	for _, k := range bo.Forbidden {
+		bo.forbiddenSet[k] = true
+	}
+
+	required := append(bo.Required[:len(bo.Required):len(bo.Required)], bo.RequiredPositive...)
+	for _, k := range append(required, bo.RequiredNonEmpty...) {
+		if bo.forbiddenSet[k] {
+			return bo, ConfigError{fmt.Sprintf("key <%s> is both required and forbidden", k)}
+		}
+		if _, ok := bo.Defaults[k]; ok {
+			return bo, ConfigError{fmt.Sprintf("key <%s> is both required and defaulted", k)}
+		}
+	}
+	for k, raw := range bo.Defaults {
+		if bo.forbiddenSet[k] {
+			return bo, ConfigError{fmt.Sprintf("key <%s> is both forbidden and defaulted", k)}
+		}
+		if !json.Valid(raw) {
+			return bo, ConfigError{fmt.Sprintf("Defaults: key <%s> holds invalid json", k)}
+		}
+	}
+
+	if bo.KeyPattern != "" {
+		re, err := regexp.Compile(bo.KeyPattern)
+		if err != nil {
+			return bo, ConfigError{fmt.Sprintf("KeyPattern: %v", err)}
+		}
+		bo.keyPattern = re
+	}
+
+	if len(bo.Pattern) != 0 {
+		bo.pattern = map[string]*regexp.Regexp{}
+		for k, expr := range bo.Pattern {
+			re, err := regexp.Compile(expr)
+			if err != nil {
+				return bo, ConfigError{fmt.Sprintf("Pattern: key <%s>: %v", k, err)}
+			}
+			bo.pattern[k] = re
+		}
+	}
+
+	if len(bo.PatternAnyOf) != 0 {
+		bo.patterns = map[string][]*regexp.Regexp{}
+		for k, exprs := range bo.PatternAnyOf {
+			for _, expr := range exprs {
+				re, err := regexp.Compile(expr)
+				if err != nil {
+					return bo, ConfigError{fmt.Sprintf("PatternAnyOf: key <%s>: %v", k, err)}
+				}
+				bo.patterns[k] = append(bo.patterns[k], re)
+			}
+		}
+	}
+
+	if len(bo.FieldOptions) != 0 {
+		bo.fieldOptions = map[string]builtOptions{}
+		for k, fo := range bo.FieldOptions {
+			// a nil entry places no rules on its key, as nil Options do
+			if fo == nil {
+				fo = &Options{}
+			}
+			child, err := compileOptions(*fo)
+			if err != nil {
+				return bo, err
+			}
+			bo.fieldOptions[k] = child
+		}
+	}
+
+	if bo.Decode == nil {
+		bo.Decode = json.Unmarshal
+	}
+
+	bo.rulesPerObject = len(bo.MaxItemsBeforeDecode) + len(bo.Required) + len(bo.RequiredIf) +
+		len(bo.RequiredPaths) + len(bo.RequiredPositive) + len(bo.RequiredNonEmpty) + len(bo.WholeNumber) +
+		len(bo.RejectScientificNotation) + len(bo.Types) + len(bo.Min) + len(bo.Max) +
+		len(bo.MinLength) + len(bo.MaxLength) + len(bo.pattern) + len(bo.patterns) +
+		len(bo.HomogeneousArrays) + len(bo.AtLeastNOf) + len(bo.MutuallyExclusive) + len(bo.ExactlyOneOf) +
+		len(bo.AtLeastOne) + len(bo.Forbidden) + len(bo.FieldEquals) +
+		len(bo.Enum) + len(bo.EnumWhen) + len(bo.AllowedNumbers) + len(bo.fieldOptions)
+
+	return bo, nil
+}
+
+// dependsOnValue reports if any of the options depend on the destination.
+func (bo builtOptions) dependsOnValue() bool {
+	return bo.checksUnknownKeys() || bo.ReportUnknownKeys || len(bo.Min)+len(bo.Max) != 0
+}
+
+// checksUnknownKeys reports if keys that aren't fields of the destination
+// struct should be checked by checkUnknownKeys.
+func (bo builtOptions) checksUnknownKeys() bool {
+	return bo.Strict || bo.Pedantic || bo.UnknownFieldHandler != nil
+}
+
+// isUnknownKey reports if k isn't a field of the destination struct and isn't
+// otherwise accounted for, as forbidden keys and meta keys are.
+func (bo builtOptions) isUnknownKey(k string) bool {
+	return !bo.isMetaKey(k) && !bo.forbiddenSet[k] && !bo.structKeys[strings.ToLower(k)]
+}
+
+// forValue returns bo completed with the state derived from the destination
+// v, which Strict, Pedantic, UnknownFieldHandler, ReportUnknownKeys, and the
+// ranges of Min and Max depend on.
+func (bo builtOptions) forValue(v interface{}) builtOptions {
+	if !bo.dependsOnValue() || v == nil {
+		return bo
+	}
+	fields, ok := structFields(reflect.TypeOf(v))
+	if !ok {
+		return bo
+	}
+
+	if len(bo.Min)+len(bo.Max) != 0 {
+		bo.intFields = intFields(reflect.TypeOf(v), bo.Min, bo.Max)
+	}
+	if !bo.checksUnknownKeys() && !bo.ReportUnknownKeys {
+		return bo
+	}
+	bo.structKeys = map[string]bool{}
+	for _, name := range fields {
+		bo.structKeys[strings.ToLower(name)] = true
+	}
+	if bo.Pedantic {
+		n := len(bo.Required)
+		bo.Required = pedanticRequired(bo.Required, fields, bo.forbiddenSet)
+		bo.rulesPerObject += len(bo.Required) - n
+	}
+	return bo
+}
+
+// presenceOnly reports if o only holds options that are decided by which
+// top-level keys are present, so that their values needn't be decoded.
+func presenceOnly(o Options) bool {
+	for _, k := range append(o.Required[:len(o.Required):len(o.Required)], o.Forbidden...) {
+		if strings.Contains(k, ".") {
+			return false
+		}
+	}
+
+	keys := Options{
+		Required:                  o.Required,
+		Forbidden:                 o.Forbidden,
+		NullNotPresent:            o.NullNotPresent,
+		GlobalNullNotPresent:      o.GlobalNullNotPresent,
+		DistinguishAbsentFromNull: o.DistinguishAbsentFromNull,
+		FailFast:                  o.FailFast,
+		MaxErrors:                 o.MaxErrors,
+		WarnOnly:                  o.WarnOnly,
+		AllowEmptyInput:           o.AllowEmptyInput,
+		MaxDistinctErrorKeys:      o.MaxDistinctErrorKeys,
+		InternKeys:                o.InternKeys,
+		ExpectedKeys:              o.ExpectedKeys,
+		RequireNonEmptyOnMarshal:  o.RequireNonEmptyOnMarshal,
+	}
+	return reflect.DeepEqual(keys, o)
+}
+
+// isMetaKey reports if k is a metadata key as described by MetaKeyPrefix.
+func (bo builtOptions) isMetaKey(k string) bool {
+	return bo.MetaKeyPrefix != "" && strings.HasPrefix(k, bo.MetaKeyPrefix)
+}
+
+// deep reports if any of the options require visiting nested values.
+func (bo builtOptions) deep() bool {
+	return bo.ApplyRecursively || bo.MaxItemsDeep > 0 || bo.RejectUndefinedString
+}
+
+// given a key return if null should be considered a "set" value
+func (bo builtOptions) nullIsPresent(s string) bool {
+	if bo.GlobalNullNotPresent {
+		return false
+	}
+
+	return !bo.nullNotPresentSet[s]
+}
+
+func Unmarshal(data []byte, v interface{}) error {
+	// defer unmarshal calls to UnmarshalX; this will eventually let us take over
+	// unmarshalling of nested structs if appropriate as well as act on struct
+	// tag annotations.
+	return UnmarshalX(data, v, nil)
+}
+
+// UnmarshalX reads json from data and stores keys into v while enforcing any
+// Options that were passed in. Passing pcfg as nil will result in no options
+// being applied (i.e. it behaves as json.Unmarshal). data may hold an object
+// or an array of objects, in which case the Options are enforced on each.
+func UnmarshalX(data []byte, v interface{}, pcfg *Options) error {
+	_, err := UnmarshalWithResult(data, v, pcfg)
+	return err
+}
+
+// UnmarshalXContext behaves as UnmarshalX but abandons validation and decoding
+// once ctx is done, returning ctx's error. ctx is checked as work is done, so a
+// large document stops partway through, and v is left untouched.
+func UnmarshalXContext(ctx context.Context, data []byte, v interface{}, opts *Options) error {
+	_, err := unmarshalWithResult(ctx, data, v, opts)
+	return err
+}
+
+// UnmarshalErrors behaves as UnmarshalX but returns the validation errors
+// directly, or nothing on success. Any other error, such as the input not
+// matching the destination's type, is returned as a single DecodeError.
+func UnmarshalErrors(data []byte, v interface{}, pcfg *Options) []ValidationError {
+	err := UnmarshalX(data, v, pcfg)
+	switch e := err.(type) {
+	case nil:
+		return nil
+	case ErrorCollection:
+		return e.errors
+	}
+
+	ve := newError(DecodeError, "", nil)
+	ve.Detail = err.Error()
+	return []ValidationError{ve}
+}
+
+// UnmarshalAll behaves as UnmarshalX but validates data against each of
+// optsList in turn, such as a base policy and an overlay, returning the errors
+// from all of them in a single ErrorCollection. If a set with FailFast reports
+// errors the remaining sets are skipped. v is only decoded, with
+// json.Unmarshal, once every set has passed; options that rewrite the
+// document, such as StripNulls, don't affect what is decoded, and checks on the
+// decoded value, such as RejectNaNFields, are skipped. Each set's OnSuccess is
+// called, in order, once v has been decoded.
+func UnmarshalAll(data []byte, v interface{}, optsList ...*Options) error {
+	var errs []ValidationError
+	for _, pcfg := range optsList {
+		if pcfg == nil {
+			continue
+		}
+		cfg := *pcfg
+		cfg.Decode = func([]byte, interface{}) error { return nil }
+		// v is never decoded into here so checks on the decoded value can't run
+		cfg.RejectNaNFields, cfg.VerifyRoundTrip = false, false
+		cfg.OnSuccess = nil
+
+		_, err := UnmarshalWithResult(data, v, &cfg)
+		ec, ok := err.(ErrorCollection)
+		if err != nil && !ok {
+			return err
+		}
+		errs = append(errs, ec.errors...)
+		if cfg.FailFast && len(ec.errors) != 0 {
+			break
+		}
+	}
+
+	if len(errs) != 0 {
+		return ErrorCollection{errors: errs}
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return err
+	}
+	for _, pcfg := range optsList {
+		if pcfg != nil && pcfg.OnSuccess != nil {
+			pcfg.OnSuccess(v)
+		}
+	}
+	return nil
+}
+
+// ValidationResult describes the validation performed while unmarshalling.
+type ValidationResult struct {
+	// Errors holds every validation error that was encountered.
+	Errors []ValidationError
+
+	// Warnings holds the findings that would have been errors if WarnOnly had
+	// not been set.
+	Warnings []ValidationError
+
+	// ShortCircuited is set if FailFast or MaxErrors stopped validation early,
+	// in which case Errors may not hold every problem with the input.
+	ShortCircuited bool
+
+	// Canonical holds the canonical form of the document if Canonicalize was
+	// set.
+	Canonical []byte
+
+	// UnknownKeys lists the keys which aren't fields of the destination struct,
+	// in sorted order and as paths for the elements of an array, if
+	// ReportUnknownKeys was set.
+	UnknownKeys []string
+}
+
+// Merge combines r with the result of another validation pass, such as one
+// over a different part of a request. The canonical form of r, if any, is
+// kept.
+func (r ValidationResult) Merge(other ValidationResult) ValidationResult {
+	return ValidationResult{
+		Errors:         append(r.Errors[:len(r.Errors):len(r.Errors)], other.Errors...),
+		Warnings:       append(r.Warnings[:len(r.Warnings):len(r.Warnings)], other.Warnings...),
+		ShortCircuited: r.ShortCircuited || other.ShortCircuited,
+		Canonical:      r.Canonical,
+		UnknownKeys:    append(r.UnknownKeys[:len(r.UnknownKeys):len(r.UnknownKeys)], other.UnknownKeys...),
+	}
+}
+
+// UnmarshalWithResult behaves as UnmarshalX but also returns a
+// ValidationResult describing the validation that was performed.
+func UnmarshalWithResult(data []byte, v interface{}, pcfg *Options) (ValidationResult, error) {
+	return unmarshalWithResult(context.Background(), data, v, pcfg)
+}
+
+// unmarshalWithResult implements UnmarshalWithResult, abandoning validation
+// with ctx's error if ctx is done before it completes.
+func unmarshalWithResult(ctx context.Context, data []byte, v interface{}, pcfg *Options) (ValidationResult, error) {
+	if err := ctx.Err(); err != nil {
+		return ValidationResult{}, err
+	}
+	if pcfg == nil {
+		// eventually we'll still need to UnmarshalX on the children in case they
+		// have options configured
+		return ValidationResult{}, json.Unmarshal(data, v)
+	}
+
+	// build interal state
+	cfg, err := prepareOptions(*pcfg, v)
+	if err != nil {
+		return ValidationResult{}, err
+	}
+	return unmarshalBuilt(ctx, data, v, cfg)
+}
+
+// unmarshalBuilt validates data against cfg and decodes it into v, calling
+// OnSuccess if that succeeded.
+func unmarshalBuilt(ctx context.Context, data []byte, v interface{}, cfg builtOptions) (ValidationResult, error) {
+	res, err := decodeBuilt(ctx, data, v, cfg)
+	if err == nil && cfg.OnSuccess != nil {
+		cfg.OnSuccess(v)
+	}
+	return res, err
+}
+
+func decodeBuilt(ctx context.Context, data []byte, v interface{}, cfg builtOptions) (ValidationResult, error) {
+	switch c := firstByte(data); {
+	case c == '[':
+		return decodeArrayBuilt(ctx, data, v, cfg)
+	case c != 0 && c != '{' && json.Valid(data):
+		ve := newError(TypeMismatch, "", nil)
+		ve.Detail = "want object or array, got " + jsonKind(data)
+		res := ValidationResult{Errors: []ValidationError{ve}}
+		return res, ErrorCollection{errors: res.Errors}
+	}
+
+	// empty input is validated as an empty object so that any Required keys
+	// are reported as missing
+	empty := len(bytes.TrimSpace(data)) == 0
+
+	var dest map[string]*json.RawMessage
+	var err error
+	switch {
+	case empty:
+		dest = map[string]*json.RawMessage{}
+	case cfg.presenceOnly:
+		dest, err = decodePresence(data, cfg.InternKeys, cfg.ExpectedKeys)
+	default:
+		dest, err = decodeObject(data, cfg.InternKeys, cfg.ExpectedKeys)
+	}
+	if err != nil {
+		return syntaxError(data, err)
+	}
+
+	vd := validator{cfg: cfg, ctx: ctx}
+	rewrite := vd.resolveAliases(nil, dest)
+	if !vd.done {
+		vd.validateObject(nil, dest)
+	}
+	if !vd.done && cfg.structKeys != nil {
+		vd.unknownKeys(nil, dest)
+	}
+	if !vd.done && !empty && len(cfg.KeyOrder) != 0 {
+		if err := vd.checkKeyOrder(data); err != nil {
+			return ValidationResult{}, err
+		}
+	}
+	if !vd.done && !empty && (cfg.RejectDuplicateKeys || cfg.ForbidCaseInsensitiveDuplicateKeys) {
+		if err := vd.checkDuplicateKeys(json.NewDecoder(bytes.NewReader(data)), nil); err != nil {
+			return ValidationResult{}, err
+		}
+	}
+	if empty && len(vd.errors) == 0 && !cfg.AllowEmptyInput {
+		vd.addError(newError(EmptyInput, "", nil))
+	}
+
+	if vd.ctxErr != nil {
+		return ValidationResult{}, vd.ctxErr
+	}
+
+	res, err := vd.result()
+	if err != nil || empty {
+		return res, err
+	}
+
+	if cfg.applyDefaults(dest) {
+		rewrite = true
+	}
+	switch {
+	case cfg.StripNulls:
+		data, err = stripNulls(dest, cfg.ApplyRecursively)
+	case rewrite:
+		data, err = json.Marshal(dest)
+	}
+	if err != nil {
+		return res, err
+	}
+	return finishDecode(ctx, data, v, cfg, res)
+}
+
+// decodeArrayBuilt is as decodeBuilt for a document holding an array. Each
+// element must be an object and is validated as a top-level object would be,
+// with the path to any error starting at the element's index. KeyOrder only
+// applies to a top-level object and is ignored.
+func decodeArrayBuilt(ctx context.Context, data []byte, v interface{}, cfg builtOptions) (ValidationResult, error) {
+	var elems []json.RawMessage
+	if err := json.Unmarshal(data, &elems); err != nil {
+		return syntaxError(data, err)
+	}
+
+	vd := validator{cfg: cfg, ctx: ctx}
+	if max := cfg.MaxItemsDeep; vd.spend(len(elems)) && max > 0 && len(elems) > max {
+		ve := newError(LengthViolation, "", nil)
+		ve.Detail = fmt.Sprintf("%d items exceeds the maximum of %d", len(elems), max)
+		vd.addError(ve)
+	}
+	objs := make([]map[string]*json.RawMessage, len(elems))
+	rewrite := false
+	for i, raw := range elems {
+		if vd.done {
+			break
+		}
+		path := appendIndex(nil, i)
+		if firstByte(raw) != '{' {
+			ve := newError(TypeMismatch, strconv.Itoa(i), path)
+			ve.Detail = "want object, got " + jsonKind(raw)
+			vd.addError(ve)
+			continue
+		}
+
+		obj, err := decodeObject(raw, cfg.InternKeys, cfg.ExpectedKeys)
+		if err != nil {
+			return syntaxError(data, err)
+		}
+		objs[i] = obj
+		if vd.resolveAliases(path, obj) {
+			rewrite = true
+		}
+		if !vd.done {
+			vd.validateObject(path, obj)
+		}
+		if !vd.done && cfg.structKeys != nil {
+			vd.unknownKeys(path, obj)
+		}
+	}
+	if !vd.done && (cfg.RejectDuplicateKeys || cfg.ForbidCaseInsensitiveDuplicateKeys) {
+		if err := vd.checkDuplicateKeys(json.NewDecoder(bytes.NewReader(data)), nil); err != nil {
+			return ValidationResult{}, err
+		}
+	}
+
+	if vd.ctxErr != nil {
+		return ValidationResult{}, vd.ctxErr
+	}
+
+	res, err := vd.result()
+	if err != nil {
+		return res, err
+	}
+
+	for _, obj := range objs {
+		if obj != nil && cfg.applyDefaults(obj) {
+			rewrite = true
+		}
+	}
+	if cfg.StripNulls || rewrite {
+		for i, obj := range objs {
+			switch {
+			case obj == nil:
+			case cfg.StripNulls:
+				elems[i], err = stripNulls(obj, cfg.ApplyRecursively)
+			default:
+				elems[i], err = json.Marshal(obj)
+			}
+			if err != nil {
+				return res, err
+			}
+		}
+		if data, err = json.Marshal(elems); err != nil {
+			return res, err
+		}
+	}
+	return finishDecode(ctx, data, v, cfg, res)
+}
+
+// applyDefaults adds the Defaults for the keys absent from obj and reports if
+// any were added.
+func (bo builtOptions) applyDefaults(obj map[string]*json.RawMessage) bool {
+	added := false
+	for k, def := range bo.Defaults {
+		if raw, ok := obj[k]; ok && (raw != nil || bo.nullIsPresent(k)) {
+			continue
+		}
+		def := def
+		obj[k] = &def
+		added = true
+	}
+	return added
+}
+
+// finishDecode decodes the validated document in data into v, after
+// canonicalizing it if required, and runs any checks on the decoded value.
+// Their errors are reported along with those in res. v is left untouched if
+// ctx is done.
+func finishDecode(ctx context.Context, data []byte, v interface{}, cfg builtOptions, res ValidationResult) (ValidationResult, error) {
+	if err := ctx.Err(); err != nil {
+		return ValidationResult{}, err
+	}
+	if cfg.Canonicalize {
+		var err error
+		if data, err = canonicalize(data); err != nil {
+			return res, err
+		}
+		res.Canonical = data
+	}
+	if cfg.DisallowUnknownFields && v != nil {
+		if p, ok := firstUnknownField(data, reflect.TypeOf(v), nil); ok {
+			// reported like any other error, so WarnOnly and the error limits
+			// apply to it
+			unknown := validator{cfg: cfg}
+			unknown.addError(newError(UnknownKey, p.last(), p))
+			unknownRes, err := unknown.result()
+			if res = res.Merge(unknownRes); err != nil {
+				return res, err
+			}
+		}
+	}
+	if err := cfg.Decode(data, v); err != nil {
+		return syntaxError(data, err)
+	}
+
+	if !cfg.RejectNaNFields && !cfg.VerifyRoundTrip {
+		return res, nil
+	}
+
+	// checks on the decoded value are reported along with any warnings from
+	// validating the input
+	post := validator{cfg: cfg}
+	if cfg.RejectNaNFields {
+		post.checkFinite(nil, reflect.ValueOf(v))
+	}
+	if !post.done && cfg.VerifyRoundTrip {
+		if err := post.checkRoundTrip(data, v); err != nil {
+			return res, err
+		}
+	}
+	postRes, err := post.result()
+	return res.Merge(postRes), err
+}
+
+// syntaxError converts a *json.SyntaxError from decoding data into an
+// ErrorCollection holding a DecodeError which locates the problem by line and
+// column. Any other error is returned unchanged.
+func syntaxError(data []byte, err error) (ValidationResult, error) {
+	se, ok := err.(*json.SyntaxError)
+	if !ok {
+		return ValidationResult{}, err
+	}
+
+	off := int(se.Offset)
+	if off > len(data) {
+		off = len(data)
+	}
+	line := 1 + bytes.Count(data[:off], []byte("\n"))
+	col := off - 1 - bytes.LastIndexByte(data[:off], '\n')
+
+	ve := newError(DecodeError, "", nil)
+	ve.Detail = fmt.Sprintf("line %d, column %d: %v", line, col, se)
+	res := ValidationResult{Errors: []ValidationError{ve}}
+	return res, ErrorCollection{errors: res.Errors}
+}
+
+// validator holds the state of a single validation pass over a document.
+type validator struct {
+	cfg    builtOptions
+	errors []ValidationError
+	done   bool
+
+	// unknown holds the keys found for ReportUnknownKeys.
+	unknown []string
+
+	// errorKeys and suppressed track the keys errors were reported and
+	// dropped for when MaxDistinctErrorKeys is set.
+	errorKeys  map[string]bool
+	suppressed map[string]bool
+
+	// spent is the work charged against the validation budget so far.
+	spent     int64
+	exhausted bool
+
+	// ctx is checked as work is spent; ctxErr holds its error once it is
+	// done, at which point validation stops.
+	ctx    context.Context
+	ctxErr error
+}
+
+// validationBudget is the limit set by SetValidationBudget; it is accessed
+// atomically.
+var validationBudget int64
+
+// SetValidationBudget caps the work a single call to UnmarshalX may spend
+// validating a document, as a blunt guard against adversarial input. Work is
+// counted as each key or array element visited, each rule checked against an
+// object, and each byte of the nested objects and arrays walked by the options
+// that look inside values, such as ApplyRecursively and MaxItemsDeep. Once the
+// budget is spent validation stops with a BudgetExceeded error. A budget of
+// zero or less, the default, is unlimited.
+func SetValidationBudget(n int) {
+	atomic.StoreInt64(&validationBudget, int64(n))
+}
+
+// spend charges n units of work against the validation budget. It returns
+// false, having reported a BudgetExceeded error, once the budget is used up,
+// or if the validator's context is done.
+func (vd *validator) spend(n int) bool {
+	if vd.exhausted || vd.cancelled() {
+		return false
+	}
+
+	vd.spent += int64(n)
+	limit := atomic.LoadInt64(&validationBudget)
+	if limit <= 0 || vd.spent <= limit {
+		return true
+	}
+
+	ve := newError(BudgetExceeded, "", nil)
+	ve.Detail = fmt.Sprintf("exceeded %d units of work", limit)
+	vd.errors = append(vd.errors, ve)
+	vd.exhausted, vd.done = true, true
+	return false
+}
+
+// cancelled reports if the validator's context is done, at which point
+// validation stops with its error.
+func (vd *validator) cancelled() bool {
+	if vd.ctxErr == nil && vd.ctx != nil {
+		if err := vd.ctx.Err(); err != nil {
+			vd.ctxErr, vd.done = err, true
+		}
+	}
+	return vd.ctxErr != nil
+}
+
+// addError records ve and reports whether validation should stop.
+func (vd *validator) addError(ve ValidationError) bool {
+	if max, k := vd.cfg.MaxDistinctErrorKeys, ruleKey(ve); max > 0 && !vd.errorKeys[k] {
+		if vd.errorKeys == nil {
+			vd.errorKeys, vd.suppressed = map[string]bool{}, map[string]bool{}
+		}
+		if len(vd.errorKeys) >= max {
+			vd.suppressed[k] = true
+			return vd.done
+		}
+		vd.errorKeys[k] = true
+	}
+
+	vd.errors = append(vd.errors, ve)
+	if vd.cfg.FailFast || vd.truncated() {
+		vd.done = true
+	}
+	return vd.done
+}
+
+// result summarizes the errors collected by vd once validation is over. The
+// returned error is an ErrorCollection if the errors should fail the decode.
+func (vd *validator) result() (ValidationResult, error) {
+	if len(vd.suppressed) != 0 {
+		ve := newError(SuppressedErrors, "", nil)
+		ve.Detail = fmt.Sprintf("errors for %d more keys were not reported", len(vd.suppressed))
+		vd.errors = append(vd.errors, ve)
+	}
+
+	res := ValidationResult{Errors: vd.errors, ShortCircuited: vd.done, UnknownKeys: vd.unknown}
+	if vd.cfg.WarnOnly {
+		res.Errors, res.Warnings = nil, vd.errors
+	}
+	if len(res.Errors) != 0 {
+		return res, ErrorCollection{errors: res.Errors, truncated: vd.truncated()}
+	}
+	return res, nil
+}
+
+// truncated reports if vd has found as many errors as MaxErrors allows.
+func (vd *validator) truncated() bool {
+	return vd.cfg.MaxErrors > 0 && len(vd.errors) >= vd.cfg.MaxErrors
+}
+
+// checkKeyOrder reports the first of the KeyOrder keys to appear out of order
+// in the top-level object of data.
+func (vd *validator) checkKeyOrder(data []byte) error {
+	keys, err := objectKeys(data)
+	if err != nil {
+		return err
+	}
+
+	rank := map[string]int{}
+	for i, k := range vd.cfg.KeyOrder {
+		rank[k] = i
+	}
+
+	last := ""
+	for _, k := range keys {
+		r, ok := rank[k]
+		if !ok {
+			continue
+		}
+		if last != "" && r < rank[last] {
+			ve := newError(OutOfOrder, k, appendPath(nil, k))
+			ve.Detail = fmt.Sprintf("must appear before <%s>", last)
+			vd.addError(ve)
+			return nil
+		}
+		last = k
+	}
+	return nil
+}
+
+// checkDuplicateKeys reads the next value from dec, which is at path, and
+// reports a DuplicateKey error for each key repeated within any of its
+// objects, exactly or ignoring case as the options require. Keys are reported
+// once per object however often they repeat.
+func (vd *validator) checkDuplicateKeys(dec *json.Decoder, path docPath) error {
+	tok, err := dec.Token()
+	if err != nil {
+		return err
+	}
+
+	switch tok {
+	case json.Delim('{'):
+		seen := map[string]int{}
+		folded := map[string]string{}
+		for dec.More() && !vd.done {
+			tok, err := dec.Token()
+			if err != nil {
+				return err
+			}
+			key := tok.(string)
+			seen[key]++
+			first, ok := folded[strings.ToLower(key)]
+			switch {
+			case vd.cfg.RejectDuplicateKeys && seen[key] == 2:
+				vd.addError(newError(DuplicateKey, key, appendPath(path, key)))
+			case vd.cfg.ForbidCaseInsensitiveDuplicateKeys && ok && first != key && seen[key] == 1:
+				ve := newError(DuplicateKey, key, appendPath(path, key))
+				ve.Detail = fmt.Sprintf("ignoring case, as <%s>", first)
+				vd.addError(ve)
+			case !ok:
+				folded[strings.ToLower(key)] = key
+			}
+			if err := vd.checkDuplicateKeys(dec, appendPath(path, key)); err != nil {
+				return err
+			}
+		}
+	case json.Delim('['):
+		for i := 0; dec.More() && !vd.done; i++ {
+			if err := vd.checkDuplicateKeys(dec, appendIndex(path, i)); err != nil {
+				return err
+			}
+		}
+	default:
+		return nil
+	}
+
+	if vd.done {
+		return nil
+	}
+	// consume the closing delimiter
+	_, err = dec.Token()
+	return err
+}
+
+// resolveAliases renames any aliased keys in obj, which is at path, to their
+// canonical names and reports if obj was modified.
+func (vd *validator) resolveAliases(path docPath, obj map[string]*json.RawMessage) bool {
+	changed := false
+	for _, key := range sortedListKeys(vd.cfg.Aliases) {
+		_, found := obj[key]
+		for _, alias := range vd.cfg.Aliases[key] {
+			raw, ok := obj[alias]
+			if !ok {
+				continue
+			}
+			changed = true
+			delete(obj, alias)
+
+			if !found {
+				obj[key], found = raw, true
+				continue
+			}
+			if vd.cfg.ForbidAliasCollision {
+				ve := newError(AliasCollision, alias, appendPath(path, alias))
+				ve.Detail = fmt.Sprintf("<%s> is already set", key)
+				if vd.addError(ve) {
+					return changed
+				}
+			}
+		}
+	}
+	return changed
+}
+
+func sortedListKeys(m map[string][]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// present reports if key s was set in obj, taking null handling into account.
+func (vd *validator) present(obj map[string]*json.RawMessage, s string) bool {
+	v, _, ok := lookupKey(obj, s)
+	switch {
+	case !ok:
+		return false
+	case v == nil && !vd.cfg.nullIsPresent(s):
+		return false
+	}
+	return true
+}
+
+// redacted replaces the captured values of keys listed in RedactKeys.
+var redacted = json.RawMessage(`"[redacted]"`)
+
+// capture returns a copy of raw, the value of key, for reporting in an error.
+// The copy is needed as raw may alias the caller's input.
+func (vd *validator) capture(key string, raw *json.RawMessage) json.RawMessage {
+	switch {
+	case vd.cfg.redactSet[key]:
+		return append(json.RawMessage(nil), redacted...)
+	case raw == nil:
+		return json.RawMessage("null")
+	}
+	return append(json.RawMessage(nil), *raw...)
+}
+
+// missing returns the error for required key s not being present in obj,
+// which is located at path. It is a MissingKey error unless s was set to null
+// and DistinguishAbsentFromNull is set.
+func (vd *validator) missing(obj map[string]*json.RawMessage, s string, path docPath) ValidationError {
+	_, segs, ok := lookupKey(obj, s)
+	full := append(path[:len(path):len(path)], segs...)
+	if ok && vd.cfg.DistinguishAbsentFromNull {
+		return newError(NullNotAllowed, s, full)
+	}
+	return newError(MissingKey, s, full)
+}
+
+// lookupKey finds key s in obj along with the path segments it refers to. A
+// key containing dots which isn't itself set in obj is treated as a path
+// through nested objects, such as "server.host"; only the objects along that
+// path are decoded.
+func lookupKey(obj map[string]*json.RawMessage, s string) (*json.RawMessage, docPath, bool) {
+	if raw, ok := obj[s]; ok || !strings.Contains(s, ".") {
+		return raw, appendPath(nil, s), ok
+	}
+	return lookupPath(obj, strings.Split(s, "."))
+}
+
+// validateObject enforces the configured key rules on obj, which is located
+// at path within the document, and then descends into obj's children. It
+// returns false once validation should stop.
+func (vd *validator) validateObject(path docPath, obj map[string]*json.RawMessage) bool {
+	if !vd.spend(len(obj) + vd.cfg.rulesPerObject) {
+		return false
+	}
+
+	for _, itemsKey := range sortedLengthKeys(vd.cfg.MaxItemsBeforeDecode, nil) {
+		raw := obj[itemsKey]
+		max := vd.cfg.MaxItemsBeforeDecode[itemsKey]
+		if raw == nil || firstByte(*raw) != '[' || countItems(*raw, max) <= max {
+			continue
+		}
+		ve := newError(LengthViolation, itemsKey, appendPath(path, itemsKey))
+		ve.Detail = fmt.Sprintf("more than %d items", max)
+		if vd.addError(ve) {
+			return false
+		}
+	}
+
+	required := vd.cfg.Required
+	for _, cr := range vd.cfg.RequiredIf {
+		trigger := cr.TriggerValue
+		if raw, ok := obj[cr.Trigger]; ok && canonicalEqual(raw, &trigger) {
+			required = appendNew(required[:len(required):len(required)], cr.Keys)
+		}
+	}
+
+	for _, reqKey := range required {
+		if !vd.present(obj, reqKey) && vd.addError(vd.missing(obj, reqKey, path)) {
+			return false
+		}
+	}
+
+	for _, reqPath := range vd.cfg.RequiredPaths {
+		if len(reqPath) == 0 {
+			continue
+		}
+		raw, segs, ok := lookupPath(obj, reqPath)
+		key := reqPath[len(reqPath)-1]
+		if ok && (raw != nil || vd.cfg.nullIsPresent(key)) {
+			continue
+		}
+		full := append(path[:len(path):len(path)], segs...)
+		t := MissingKey
+		if ok && vd.cfg.DistinguishAbsentFromNull {
+			t = NullNotAllowed
+		}
+		if vd.addError(newError(t, key, full)) {
+			return false
+		}
+	}
+
+	for _, posKey := range vd.cfg.RequiredPositive {
+		var ve ValidationError
+		raw, segs, _ := lookupKey(obj, posKey)
+		if n, ok := number(raw); !vd.present(obj, posKey) {
+			ve = vd.missing(obj, posKey, path)
+		} else if !ok || n <= 0 {
+			ve = newError(OutOfRange, posKey, append(path[:len(path):len(path)], segs...))
+			ve.Detail = "must be a number greater than 0"
+		} else {
+			continue
+		}
+		if vd.addError(ve) {
+			return false
+		}
+	}
+
+	for _, neKey := range vd.cfg.RequiredNonEmpty {
+		raw, segs, ok := lookupKey(obj, neKey)
+		full := append(path[:len(path):len(path)], segs...)
+		if !ok {
+			if vd.addError(newError(MissingKey, neKey, full)) {
+				return false
+			}
+			continue
+		}
+		if !isEmptyValue(raw) {
+			continue
+		}
+		ve := newError(MissingKey, neKey, full)
+		ve.Detail = "empty"
+		if vd.addError(ve) {
+			return false
+		}
+	}
+
+	for _, wholeKey := range vd.cfg.WholeNumber {
+		raw, ok := obj[wholeKey]
+		if !ok {
+			continue
+		}
+		ve := newError(InvalidNumber, wholeKey, appendPath(path, wholeKey))
+		if n, ok := number(raw); !ok {
+			ve.Detail = "not a number"
+		} else if n != math.Trunc(n) {
+			ve.Detail = "not a whole number"
+		} else {
+			continue
+		}
+		if vd.addError(ve) {
+			return false
+		}
+	}
+
+	sciKeys := vd.cfg.RejectScientificNotation
+	if vd.cfg.GlobalRejectScientificNotation {
+		sciKeys = sortedKeys(obj)
+	}
+	for _, sciKey := range sciKeys {
+		raw := obj[sciKey]
+		if raw == nil || jsonKind(*raw) != "number" || !bytes.ContainsAny(*raw, "eE") {
+			continue
+		}
+		ve := newError(InvalidNumber, sciKey, appendPath(path, sciKey))
+		ve.Detail = "written in scientific notation"
+		if vd.addError(ve) {
+			return false
+		}
+	}
+
+	for _, typeKey := range sortedStringKeys(vd.cfg.Types) {
+		raw, ok := obj[typeKey]
+		if !ok || (raw == nil && vd.cfg.nullIsPresent(typeKey)) {
+			continue
+		}
+		want, got := vd.cfg.Types[typeKey], kindOf(raw)
+		if got == want {
+			continue
+		}
+		ve := newError(TypeMismatch, typeKey, appendPath(path, typeKey))
+		ve.Detail = fmt.Sprintf("want %s, got %s", want, got)
+		if vd.addError(ve) {
+			return false
+		}
+	}
+
+	for _, numKey := range sortedBoundKeys(vd.cfg.Min, vd.cfg.Max) {
+		raw, ok := obj[numKey]
+		if !ok || (raw == nil && vd.cfg.nullIsPresent(numKey)) {
+			continue
+		}
+		min, hasMin := vd.cfg.Min[numKey]
+		max, hasMax := vd.cfg.Max[numKey]
+
+		var ve ValidationError
+		if n, ok := number(raw); !ok {
+			ve = newError(TypeMismatch, numKey, appendPath(path, numKey))
+			ve.Detail = "want number, got " + kindOf(raw)
+		} else if hasMin && compareNumber(raw, n, min) < 0 {
+			ve = newError(OutOfRange, numKey, appendPath(path, numKey))
+			ve.Detail = fmt.Sprintf("must be at least %v", min)
+		} else if hasMax && compareNumber(raw, n, max) > 0 {
+			ve = newError(OutOfRange, numKey, appendPath(path, numKey))
+			ve.Detail = fmt.Sprintf("must be at most %v", max)
+		} else if ft, ok := vd.cfg.intFields[numKey]; ok && decodedIntoDest(path) && !fitsInt(raw, ft) {
+			lo, hi, _ := intRange(ft)
+			ve = newError(OutOfRange, numKey, appendPath(path, numKey))
+			ve.Detail = fmt.Sprintf("must be between %v and %v to fit %v", lo, hi, ft)
+		} else {
+			continue
+		}
+		if vd.addError(ve) {
+			return false
+		}
+	}
+
+	for _, lenKey := range sortedLengthKeys(vd.cfg.MinLength, vd.cfg.MaxLength) {
+		raw, ok := obj[lenKey]
+		if !ok || (raw == nil && vd.cfg.nullIsPresent(lenKey)) {
+			continue
+		}
+		min, hasMin := vd.cfg.MinLength[lenKey]
+		max, hasMax := vd.cfg.MaxLength[lenKey]
+
+		var ve ValidationError
+		var s string
+		if raw == nil || json.Unmarshal(*raw, &s) != nil {
+			ve = newError(TypeMismatch, lenKey, appendPath(path, lenKey))
+			ve.Detail = "want string, got " + kindOf(raw)
+		} else if n := vd.cfg.LengthMode.length(s); hasMin && n < min {
+			ve = newError(LengthViolation, lenKey, appendPath(path, lenKey))
+			ve.Detail = fmt.Sprintf("length %d%s is below the minimum of %d", n, vd.cfg.LengthMode.unit(), min)
+		} else if hasMax && n > max {
+			ve = newError(LengthViolation, lenKey, appendPath(path, lenKey))
+			ve.Detail = fmt.Sprintf("length %d%s exceeds the maximum of %d", n, vd.cfg.LengthMode.unit(), max)
+		} else {
+			continue
+		}
+		if vd.addError(ve) {
+			return false
+		}
+	}
+
+	for _, patKey := range sortedStringKeys(vd.cfg.Pattern) {
+		raw, ok := obj[patKey]
+		if !ok || (raw == nil && vd.cfg.nullIsPresent(patKey)) {
+			continue
+		}
+
+		var ve ValidationError
+		var s string
+		if raw == nil || json.Unmarshal(*raw, &s) != nil {
+			ve = newError(TypeMismatch, patKey, appendPath(path, patKey))
+			ve.Detail = "want string, got " + kindOf(raw)
+		} else if max := vd.cfg.MaxPatternInputBytes; max > 0 && len(s) > max {
+			ve = newError(PatternMismatch, patKey, appendPath(path, patKey))
+			ve.Detail = fmt.Sprintf("%d bytes exceeds the maximum of %d checked against a pattern", len(s), max)
+		} else if !vd.cfg.pattern[patKey].MatchString(s) {
+			ve = newError(PatternMismatch, patKey, appendPath(path, patKey))
+			ve.Detail = "does not match " + vd.cfg.Pattern[patKey]
+		} else {
+			continue
+		}
+		if vd.addError(ve) {
+			return false
+		}
+	}
+
+	for _, patKey := range sortedListKeys(vd.cfg.PatternAnyOf) {
+		raw, ok := obj[patKey]
+		if !ok || (raw == nil && vd.cfg.nullIsPresent(patKey)) {
+			continue
+		}
+
+		var ve ValidationError
+		var s string
+		if raw == nil || json.Unmarshal(*raw, &s) != nil {
+			ve = newError(TypeMismatch, patKey, appendPath(path, patKey))
+			ve.Detail = "want string, got " + kindOf(raw)
+		} else if max := vd.cfg.MaxPatternInputBytes; max > 0 && len(s) > max {
+			ve = newError(PatternMismatch, patKey, appendPath(path, patKey))
+			ve.Detail = fmt.Sprintf("%d bytes exceeds the maximum of %d checked against a pattern", len(s), max)
+		} else if !matchesAny(vd.cfg.patterns[patKey], s) {
+			ve = newError(PatternMismatch, patKey, appendPath(path, patKey))
+			ve.Detail = "matches none of " + strings.Join(vd.cfg.PatternAnyOf[patKey], ", ")
+		} else {
+			continue
+		}
+		if vd.addError(ve) {
+			return false
+		}
+	}
+
+	for _, arrKey := range vd.cfg.HomogeneousArrays {
+		raw := obj[arrKey]
+		if raw == nil || firstByte(*raw) != '[' {
+			continue
+		}
+		var arr []json.RawMessage
+		if err := json.Unmarshal(*raw, &arr); err != nil {
+			continue
+		}
+		for i := 1; i < len(arr); i++ {
+			if jsonType(arr[i]) == jsonType(arr[0]) {
+				continue
+			}
+			ve := newError(MixedTypes, arrKey, appendPath(path, arrKey))
+			ve.Detail = fmt.Sprintf("element %d is %s, element 0 is %s", i, jsonType(arr[i]), jsonType(arr[0]))
+			if vd.addError(ve) {
+				return false
+			}
+			break
+		}
+	}
+
+	for _, group := range vd.cfg.AtLeastNOf {
+		n := 0
+		for _, k := range group.Keys {
+			if vd.present(obj, k) {
+				n++
+			}
+		}
+		if n >= group.N {
+			continue
+		}
+		ve := newError(AtLeastNOf, strings.Join(group.Keys, ","), path)
+		ve.Detail = fmt.Sprintf("%d present, %d required", n, group.N)
+		if vd.addError(ve) {
+			return false
+		}
+	}
+
+	for _, group := range vd.cfg.MutuallyExclusive {
+		if !vd.checkExclusive(path, obj, group, false) {
+			return false
+		}
+	}
+	for _, group := range vd.cfg.ExactlyOneOf {
+		if !vd.checkExclusive(path, obj, group, true) {
+			return false
+		}
+	}
+
+	for _, group := range vd.cfg.AtLeastOne {
+		found := false
+		for _, k := range group {
+			if vd.present(obj, k) {
+				found = true
+				break
+			}
+		}
+		if !found && vd.addError(newError(MissingGroup, strings.Join(group, ","), path)) {
+			return false
+		}
+	}
+
+	// the rules above may have been costly for a large object
+	if vd.cancelled() {
+		return false
+	}
+
+	for _, forbKey := range vd.cfg.Forbidden {
+		raw, segs, set := lookupKey(obj, forbKey)
+		if !set {
+			continue
+		}
+		ve := newError(ForbiddenKey, forbKey, append(path[:len(path):len(path)], segs...))
+		if vd.cfg.CaptureForbiddenValues {
+			ve.Value = vd.capture(forbKey, raw)
+		}
+		if vd.addError(ve) {
+			return false
+		}
+	}
+
+	if vd.cfg.keyPattern != nil {
+		for _, k := range sortedKeys(obj) {
+			if vd.cfg.isMetaKey(k) || vd.cfg.keyPattern.MatchString(k) {
+				continue
+			}
+			ve := newError(InvalidKey, k, appendPath(path, k))
+			ve.Detail = fmt.Sprintf("does not match %s", vd.cfg.KeyPattern)
+			if vd.addError(ve) {
+				return false
+			}
+		}
+	}
+
+	if vd.cfg.keysEnumSet != nil {
+		for _, k := range sortedKeys(obj) {
+			if vd.cfg.isMetaKey(k) || vd.cfg.keysEnumSet[k] {
+				continue
+			}
+			ve := newError(InvalidKey, k, appendPath(path, k))
+			ve.Detail = "not one of the allowed keys"
+			if vd.addError(ve) {
+				return false
+			}
+		}
+	}
+
+	if vd.cfg.RequireContiguousIndices {
+		for _, gap := range missingIndices(obj, vd.cfg.isMetaKey) {
+			last := gap.last
+			if last-gap.first >= maxGapIndices {
+				last = gap.first
+			}
+			for i := gap.first; i <= last; i++ {
+				if !vd.spend(1) {
+					return false
+				}
+				idx := strconv.Itoa(i)
+				ve := newError(MissingKey, idx, appendPath(path, idx))
+				if last != gap.last {
+					ve.Detail = fmt.Sprintf("missing, as are the indices through %d", gap.last)
+				}
+				if vd.addError(ve) {
+					return false
+				}
+			}
+		}
+	}
+
+	for _, pair := range vd.cfg.FieldEquals {
+		a, aok := obj[pair[0]]
+		b, bok := obj[pair[1]]
+		if !aok || !bok || canonicalEqual(a, b) {
+			continue
+		}
+		if vd.addError(newError(ComparisonFailed, pair[0]+","+pair[1], path)) {
+			return false
+		}
+	}
+
+	for _, enumKey := range sortedListKeys(vd.cfg.Enum) {
+		raw, ok := obj[enumKey]
+		if !ok || inEnum(raw, vd.cfg.Enum[enumKey], vd.cfg.EnumCaseInsensitive) {
+			continue
+		}
+		ve := newError(NotInEnum, enumKey, appendPath(path, enumKey))
+		ve.Detail = strings.Join(vd.cfg.Enum[enumKey], ", ")
+		if vd.addError(ve) {
+			return false
+		}
+	}
+
+	for _, ce := range vd.cfg.EnumWhen {
+		trigger := json.RawMessage(ce.TriggerValue)
+		if raw, ok := obj[ce.Trigger]; !ok || !canonicalEqual(raw, &trigger) {
+			continue
+		}
+		raw, ok := obj[ce.Key]
+		if !ok || inEnum(raw, ce.Allowed, vd.cfg.EnumCaseInsensitive) {
+			continue
+		}
+		ve := newError(InvalidEnum, ce.Key, appendPath(path, ce.Key))
+		ve.Detail = fmt.Sprintf("must be one of %s when <%s> is %s",
+			strings.Join(ce.Allowed, ", "), ce.Trigger, ce.TriggerValue)
+		if vd.addError(ve) {
+			return false
+		}
+	}
+
+	for _, numKey := range sortedNumberListKeys(vd.cfg.AllowedNumbers) {
+		raw, ok := obj[numKey]
+		if !ok || (raw == nil && vd.cfg.nullIsPresent(numKey)) {
+			continue
+		}
+		allowed := vd.cfg.AllowedNumbers[numKey]
+
+		var ve ValidationError
+		if n, ok := number(raw); !ok {
+			ve = newError(TypeMismatch, numKey, appendPath(path, numKey))
+			ve.Detail = "want number, got " + kindOf(raw)
+		} else if !inNumbers(n, allowed) {
+			ve = newError(InvalidEnum, numKey, appendPath(path, numKey))
+			ve.Detail = "must be one of " + joinNumbers(allowed)
+		} else {
+			continue
+		}
+		if vd.addError(ve) {
+			return false
+		}
+	}
+
+	for _, k := range sortedFieldOptionKeys(vd.cfg.fieldOptions) {
+		raw := obj[k]
+		if raw == nil || firstByte(*raw) != '{' {
+			continue
+		}
+		child := make(map[string]*json.RawMessage)
+		if err := json.Unmarshal(*raw, &child); err != nil {
+			continue
+		}
+
+		sub := validator{cfg: vd.cfg.fieldOptions[k], spent: vd.spent, ctx: vd.ctx}
+		sub.validateObject(appendPath(path, k), child)
+		vd.spent = sub.spent
+		for _, ve := range sub.errors {
+			if vd.addError(ve) {
+				return false
+			}
+		}
+		if sub.exhausted || sub.ctxErr != nil {
+			vd.exhausted, vd.ctxErr, vd.done = sub.exhausted, sub.ctxErr, true
+			return false
+		}
+	}
+
+	return vd.validateChildren(path, obj)
+}
+
+func sortedStringKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// sortedBoundKeys returns the keys with a bound in either min or max.
+func sortedBoundKeys(min, max map[string]float64) []string {
+	keys := make([]string, 0, len(min)+len(max))
+	for k := range min {
+		keys = append(keys, k)
+	}
+	for k := range max {
+		if _, ok := min[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// sortedLengthKeys returns the keys with a bound in either min or max.
+func sortedLengthKeys(min, max map[string]int) []string {
+	keys := make([]string, 0, len(min)+len(max))
+	for k := range min {
+		keys = append(keys, k)
+	}
+	for k := range max {
+		if _, ok := min[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func sortedNumberListKeys(m map[string][]float64) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func sortedFieldOptionKeys(fo map[string]builtOptions) []string {
+	keys := make([]string, 0, len(fo))
+	for k := range fo {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// validateChildren visits each of obj's values if any option requires it.
+func (vd *validator) validateChildren(path docPath, obj map[string]*json.RawMessage) bool {
+	if !vd.cfg.deep() {
+		return true
+	}
+
+	for _, k := range sortedKeys(obj) {
+		if !vd.validateValue(appendPath(path, k), obj[k]) {
+			return false
+		}
+	}
+	return true
+}
+
+// validateValue applies any value rules to raw and descends into it if it is
+// an object or an array, applying the key rules to nested objects when
+// ApplyRecursively is set and any array limits to each array encountered.
+func (vd *validator) validateValue(path docPath, raw *json.RawMessage) bool {
+	if raw == nil {
+		return true
+	}
+
+	switch firstByte(*raw) {
+	case '"':
+		var str string
+		if vd.cfg.RejectUndefinedString && json.Unmarshal(*raw, &str) == nil && str == "undefined" {
+			ve := newError(InvalidString, path.last(), path)
+			ve.Detail = `value is the string "undefined"`
+			return !vd.addError(ve)
+		}
+	case '{':
+		// raw was checked along with the rest of the document, so it is walked
+		// without being validated again, but walking it still costs its size
+		if !vd.spend(len(*raw)) {
+			return false
+		}
+		obj, err := validObject(*raw)
+		if err != nil {
+			return true
+		}
+		if vd.cfg.ApplyRecursively {
+			return vd.validateObject(path, obj)
+		}
+		return vd.validateChildren(path, obj)
+	case '[':
+		if !vd.spend(len(*raw)) {
+			return false
+		}
+		arr := validArray(*raw)
+		if !vd.spend(len(arr)) {
+			return false
+		}
+		if max := vd.cfg.MaxItemsDeep; max > 0 && len(arr) > max {
+			ve := newError(LengthViolation, path.last(), path)
+			ve.Detail = fmt.Sprintf("%d items exceeds the maximum of %d", len(arr), max)
+			if vd.addError(ve) {
+				return false
+			}
+		}
+		for i, ele := range arr {
+			if !vd.validateValue(appendIndex(path, i), ele) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// checkRoundTrip reports a RoundTripMismatch error if v, once marshalled,
+// differs from data, the input it was decoded from. Only the keys present in
+// data are compared, so fields the input didn't set are ignored. The Detail
+// lists the top-level keys that differ when both are objects.
+func (vd *validator) checkRoundTrip(data []byte, v interface{}) error {
+	out, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	var want, got interface{}
+	if err := decodeUseNumber(data, &want); err != nil {
+		return err
+	}
+	if err := decodeUseNumber(out, &got); err != nil {
+		return err
+	}
+	got = onlyKeysOf(want, got)
+	if reflect.DeepEqual(want, got) {
+		return nil
+	}
+
+	ve := newError(RoundTripMismatch, "", nil)
+	in, inOK := want.(map[string]interface{})
+	outObj, outOK := got.(map[string]interface{})
+	if inOK && outOK {
+		var keys []string
+		for k := range in {
+			if o, ok := outObj[k]; !ok || !reflect.DeepEqual(in[k], o) {
+				keys = append(keys, k)
+			}
+		}
+		sort.Strings(keys)
+		ve.Detail = "keys differ: " + strings.Join(keys, ", ")
+	}
+	vd.addError(ve)
+	return nil
+}
+
+// onlyKeysOf returns out, a decoded document, without the object keys that
+// aren't present at the same place in in, so that the two can be compared
+// over just the keys that in holds.
+func onlyKeysOf(in, out interface{}) interface{} {
+	switch iv := in.(type) {
+	case map[string]interface{}:
+		ov, ok := out.(map[string]interface{})
+		if !ok {
+			return out
+		}
+		p := make(map[string]interface{}, len(iv))
+		for k, x := range iv {
+			if o, ok := ov[k]; ok {
+				p[k] = onlyKeysOf(x, o)
+			}
+		}
+		return p
+	case []interface{}:
+		ov, ok := out.([]interface{})
+		if !ok || len(ov) != len(iv) {
+			return out
+		}
+		p := make([]interface{}, len(ov))
+		for i := range ov {
+			p[i] = onlyKeysOf(iv[i], ov[i])
+		}
+		return p
+	}
+	return out
+}
+
+// checkFinite walks the decoded value rv, located at path, reporting any
+// floats which are NaN or infinite. It returns false once validation should
+// stop.
+func (vd *validator) checkFinite(path docPath, rv reflect.Value) bool {
+	switch rv.Kind() {
+	case reflect.Float32, reflect.Float64:
+		f := rv.Float()
+		if !math.IsNaN(f) && !math.IsInf(f, 0) {
+			return true
+		}
+		ve := newError(NonFiniteNumber, path.last(), path)
+		ve.Detail = strconv.FormatFloat(f, 'g', -1, 64)
+		return !vd.addError(ve)
+	case reflect.Ptr, reflect.Interface:
+		if !rv.IsNil() {
+			return vd.checkFinite(path, rv.Elem())
+		}
+	case reflect.Struct:
+		for i := 0; i < rv.NumField(); i++ {
+			f := rv.Type().Field(i)
+			name, ok := fieldName(f)
+			if !ok {
+				continue
+			}
+			fpath := appendPath(path, name)
+			if f.Anonymous && !hasJSONName(f) {
+				// fields of embedded structs are promoted into their parent
+				fpath = path
+			}
+			if !vd.checkFinite(fpath, rv.Field(i)) {
+				return false
+			}
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < rv.Len(); i++ {
+			if !vd.checkFinite(appendIndex(path, i), rv.Index(i)) {
+				return false
+			}
+		}
+	case reflect.Map:
+		keys := rv.MapKeys()
+		sort.Slice(keys, func(i, j int) bool {
+			return fmt.Sprint(keys[i]) < fmt.Sprint(keys[j])
+		})
+		for _, k := range keys {
+			if !vd.checkFinite(appendPath(path, fmt.Sprint(k)), rv.MapIndex(k)) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// unknownKeys records the keys of obj, which is at path, that aren't fields of
+// the destination struct if ReportUnknownKeys is set and checks them as the
+// options require. It returns false once validation should stop.
+func (vd *validator) unknownKeys(path docPath, obj map[string]*json.RawMessage) bool {
+	if vd.cfg.ReportUnknownKeys {
+		for _, k := range sortedKeys(obj) {
+			if vd.cfg.isUnknownKey(k) {
+				vd.unknown = append(vd.unknown, dottedPath(appendPath(path, k)))
+			}
+		}
+	}
+	if vd.cfg.checksUnknownKeys() {
+		return vd.checkUnknownKeys(path, obj)
+	}
+	return true
+}
+
+// checkUnknownKeys reports an UnknownKey error for each key of obj, which is
+// at path, that isn't a field of the destination struct, or leaves it to the
+// UnknownFieldHandler. It returns false once validation should stop.
+func (vd *validator) checkUnknownKeys(path docPath, obj map[string]*json.RawMessage) bool {
+	var collapsed []string
+	for _, k := range sortedKeys(obj) {
+		// forbidden keys are already reported as such
+		if !vd.cfg.isUnknownKey(k) {
+			continue
+		}
+		ve := newError(UnknownKey, k, appendPath(path, k))
+		if vd.cfg.CollapseUnknownKeys && vd.cfg.UnknownFieldHandler == nil {
+			collapsed = append(collapsed, k)
+			continue
+		}
+		if h := vd.cfg.UnknownFieldHandler; h != nil {
+			raw := json.RawMessage("null")
+			if obj[k] != nil {
+				raw = *obj[k]
+			}
+			err := h(k, raw)
+			if err == nil {
+				continue
+			}
+			if hve, ok := err.(ValidationError); ok {
+				ve = hve
+			} else {
+				ve.Detail = err.Error()
+			}
+		}
+		if vd.addError(ve) {
+			return false
+		}
+	}
+	if len(collapsed) > 0 {
+		return !vd.addError(newError(UnknownKey, strings.Join(collapsed, ","), path))
+	}
+	return true
+}
+
+// checkExclusive reports a ConflictingKeys error if more than one key of group
+// is present in obj, which is at path, and if required a MissingGroup error if
+// none are. It returns false once validation should stop.
+func (vd *validator) checkExclusive(path docPath, obj map[string]*json.RawMessage, group []string, required bool) bool {
+	var set []string
+	for _, k := range group {
+		if vd.present(obj, k) {
+			set = append(set, k)
+		}
+	}
+
+	var ve ValidationError
+	switch {
+	case len(set) > 1:
+		ve = newError(ConflictingKeys, strings.Join(group, ","), path)
+		ve.Detail = "found " + strings.Join(set, ", ")
+	case len(set) == 0 && required:
+		ve = newError(MissingGroup, strings.Join(group, ","), path)
+	default:
+		return true
+	}
+	return !vd.addError(ve)
+}
+
+// appendNew appends the keys which aren't already in list to it.
+func appendNew(list, keys []string) []string {
+	for _, k := range keys {
+		found := false
+		for _, l := range list {
+			if l == k {
+				found = true
+				break
+			}
+		}
+		if !found {
+			list = append(list, k)
+		}
+	}
+	return list
+}
+
+// pedanticRequired returns required extended with the struct fields which
+// aren't already required or forbidden. required itself is not modified.
+func pedanticRequired(required, fields []string, forbidden map[string]bool) []string {
+	merged := required[:len(required):len(required)]
+	seen := map[string]bool{}
+	for _, k := range required {
+		seen[k] = true
+	}
+	for _, name := range fields {
+		if !seen[name] && !forbidden[name] {
+			seen[name] = true
+			merged = append(merged, name)
+		}
+	}
+	return merged
+}
+
+// structFields returns the json names of the fields of t, following any
+// pointers and, for documents holding an array, slices and arrays, in field
+// order. It returns false if t isn't a struct.
+func structFields(t reflect.Type) ([]string, bool) {
+	t, ok := destStruct(t)
+	if !ok {
+		return nil, false
+	}
+
+	var names []string
+	addStructFields(t, func(name string, _ reflect.Type) {
+		names = append(names, name)
+	}, map[reflect.Type]bool{})
+	return names, true
+}
+
+// destStruct returns the struct type a document is decoded into for t,
+// following any pointers and, for documents holding an array, slices and
+// arrays. It returns false if there is none.
+func destStruct(t reflect.Type) (reflect.Type, bool) {
+	for t.Kind() == reflect.Ptr || t.Kind() == reflect.Slice || t.Kind() == reflect.Array {
+		t = t.Elem()
+	}
+	return t, t.Kind() == reflect.Struct
+}
+
+// intFields returns the types of the integer fields of the struct
+// destination t which the keys of min and max, matched case-insensitively as
+// encoding/json does, are decoded into.
+func intFields(t reflect.Type, min, max map[string]float64) map[string]reflect.Type {
+	t, ok := destStruct(t)
+	if !ok {
+		return nil
+	}
+	types := map[string]reflect.Type{}
+	addStructFields(t, func(name string, ft reflect.Type) {
+		if _, ok := types[strings.ToLower(name)]; !ok {
+			types[strings.ToLower(name)] = ft
+		}
+	}, map[reflect.Type]bool{})
+
+	fields := map[string]reflect.Type{}
+	for _, k := range sortedBoundKeys(min, max) {
+		ft := types[strings.ToLower(k)]
+		for ft != nil && ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+		if _, _, ok := intRange(ft); ok {
+			fields[k] = ft
+		}
+	}
+	return fields
+}
+
+// intRange returns the smallest and largest values of the integer type t, or
+// false if t isn't an integer type.
+func intRange(t reflect.Type) (*big.Int, *big.Int, bool) {
+	if t == nil {
+		return nil, nil, false
+	}
+	one := big.NewInt(1)
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		max := new(big.Int).Lsh(one, uint(t.Bits()-1))
+		return new(big.Int).Neg(max), max.Sub(max, one), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		max := new(big.Int).Lsh(one, uint(t.Bits()))
+		return new(big.Int), max.Sub(max, one), true
+	}
+	return nil, nil, false
+}
+
+// fitsInt reports if the number held in raw lies within the range of the
+// integer type t.
+func fitsInt(raw *json.RawMessage, t reflect.Type) bool {
+	n, ok := new(big.Rat).SetString(string(bytes.TrimSpace(*raw)))
+	if !ok {
+		return true
+	}
+	min, max, _ := intRange(t)
+	return n.Cmp(new(big.Rat).SetInt(min)) >= 0 && n.Cmp(new(big.Rat).SetInt(max)) <= 0
+}
+
+// addStructFields calls add with the json name and type of each of t's
+// fields, descending into embedded structs whose fields are promoted. seen
+// guards against cycles through embedded pointers.
+func addStructFields(t reflect.Type, add func(name string, ft reflect.Type), seen map[reflect.Type]bool) {
+	if seen[t] {
+		return
+	}
+	seen[t] = true
+
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.Anonymous && !hasJSONName(f) && f.Tag.Get("json") != "-" {
+			ft := f.Type
+			if ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				addStructFields(ft, add, seen)
+				continue
+			}
+		}
+
+		name, ok := fieldName(f)
+		if !ok || (f.Anonymous && f.PkgPath != "") {
+			continue
+		}
+		add(name, f.Type)
+	}
+}
+
+var unmarshalerType = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+
+// firstUnknownField returns the path to the first key in data, which is to be
+// decoded into a value of type t at path, that doesn't match a field of the
+// struct it would be decoded into. Like Strict's check it matches keys by the
+// fields' json names case-insensitively, but it follows the fields' types into
+// nested structs, maps, slices and arrays as json.Decoder does. Values decoded
+// by a json.Unmarshaler are not examined. The keys of each object are visited
+// in sorted order.
+func firstUnknownField(data []byte, t reflect.Type, path docPath) (docPath, bool) {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if reflect.PtrTo(t).Implements(unmarshalerType) {
+		return nil, false
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		obj := make(map[string]*json.RawMessage)
+		if firstByte(data) != '{' || json.Unmarshal(data, &obj) != nil {
+			return nil, false
+		}
+		fields := map[string]reflect.Type{}
+		addStructFields(t, func(name string, ft reflect.Type) {
+			if _, ok := fields[strings.ToLower(name)]; !ok {
+				fields[strings.ToLower(name)] = ft
+			}
+		}, map[reflect.Type]bool{})
+		for _, k := range sortedKeys(obj) {
+			ft, ok := fields[strings.ToLower(k)]
+			if !ok {
+				return appendPath(path, k), true
+			}
+			if obj[k] != nil {
+				if p, ok := firstUnknownField(*obj[k], ft, appendPath(path, k)); ok {
+					return p, true
+				}
+			}
+		}
+	case reflect.Map:
+		obj := make(map[string]*json.RawMessage)
+		if firstByte(data) != '{' || json.Unmarshal(data, &obj) != nil {
+			return nil, false
+		}
+		for _, k := range sortedKeys(obj) {
+			if obj[k] != nil {
+				if p, ok := firstUnknownField(*obj[k], t.Elem(), appendPath(path, k)); ok {
+					return p, true
+				}
+			}
+		}
+	case reflect.Slice, reflect.Array:
+		var arr []json.RawMessage
+		if firstByte(data) != '[' || json.Unmarshal(data, &arr) != nil {
+			return nil, false
+		}
+		for i, ele := range arr {
+			if p, ok := firstUnknownField(ele, t.Elem(), appendIndex(path, i)); ok {
+				return p, true
+			}
+		}
+	}
+	return nil, false
+}
+
+// fieldName returns the json key for struct field f, as encoding/json would
+// choose it, or false if the field is not encoded.
+func fieldName(f reflect.StructField) (string, bool) {
+	if f.PkgPath != "" && !f.Anonymous {
+		return "", false
+	}
+	tag := f.Tag.Get("json")
+	if tag == "-" {
+		return "", false
+	}
+	if name := strings.Split(tag, ",")[0]; name != "" {
+		return name, true
+	}
+	return f.Name, true
+}
+
+// hasJSONName reports if f's json tag explicitly names the field.
+func hasJSONName(f reflect.StructField) bool {
+	return strings.Split(f.Tag.Get("json"), ",")[0] != ""
+}
+
+// stripNulls removes the null valued keys from obj and returns it re-encoded.
+// If recursive is set the same is done for every object nested within obj.
+func stripNulls(obj map[string]*json.RawMessage, recursive bool) ([]byte, error) {
+	for k, v := range obj {
+		switch {
+		case v == nil:
+			delete(obj, k)
+		case recursive:
+			stripped, err := stripNullsValue(*v)
+			if err != nil {
+				return nil, err
+			}
+			obj[k] = &stripped
+		}
+	}
+	return json.Marshal(obj)
+}
+
+// stripNullsValue strips null valued keys from any object contained in raw.
+// Array elements which are null are kept as removing them would shift the
+// remaining indices.
+func stripNullsValue(raw json.RawMessage) (json.RawMessage, error) {
+	switch firstByte(raw) {
+	case '{':
+		obj := make(map[string]*json.RawMessage)
+		if err := json.Unmarshal(raw, &obj); err != nil {
+			return nil, err
+		}
+		return stripNulls(obj, true)
+	case '[':
+		var arr []*json.RawMessage
+		if err := json.Unmarshal(raw, &arr); err != nil {
+			return nil, err
+		}
+		for i, ele := range arr {
+			if ele == nil {
+				continue
+			}
+			stripped, err := stripNullsValue(*ele)
+			if err != nil {
+				return nil, err
+			}
+			arr[i] = &stripped
+		}
+		return json.Marshal(arr)
+	}
+	return raw, nil
+}
+
+// lookupPath finds the value at path below obj, descending through objects by
+// key and arrays by index. It returns false if there is no such value; a
+// value of null is returned as nil. The docPath returned holds the segments
+// of path, with those used to index an array marked as such.
+func lookupPath(obj map[string]*json.RawMessage, path []string) (*json.RawMessage, docPath, bool) {
+	segs := appendPath(nil, path...)
+	raw, ok := obj[path[0]]
+	for n, seg := range path[1:] {
+		if !ok || raw == nil {
+			return nil, segs, false
+		}
+
+		switch firstByte(*raw) {
+		case '{':
+			child := make(map[string]*json.RawMessage)
+			if json.Unmarshal(*raw, &child) != nil {
+				return nil, segs, false
+			}
+			raw, ok = child[seg]
+		case '[':
+			var arr []*json.RawMessage
+			i, err := strconv.Atoi(seg)
+			segs[n+1].index = isIndex(seg)
+			if err != nil || json.Unmarshal(*raw, &arr) != nil || i < 0 || i >= len(arr) {
+				return nil, segs, false
+			}
+			raw = arr[i]
+		default:
+			return nil, segs, false
+		}
+	}
+	return raw, segs, ok
+}
+
+// maxGapIndices is the longest run of missing indices RequireContiguousIndices
+// reports one by one; a longer run is reported as a single error so that the
+// work done is bounded by the size of the object rather than the indices it
+// holds.
+const maxGapIndices = 16
+
+// indexGap is a run of missing indices, from first to last inclusive.
+type indexGap struct {
+	first, last int
+}
+
+// missingIndices returns the runs of indices absent from obj when it is an
+// object used as a sparse array, i.e. when every one of its keys is an
+// integer. Keys for which skip returns true are ignored.
+func missingIndices(obj map[string]*json.RawMessage, skip func(string) bool) []indexGap {
+	indices := make([]int, 0, len(obj))
+	for k := range obj {
+		if skip(k) {
+			continue
+		}
+		i, err := strconv.Atoi(k)
+		if err != nil || i < 0 || strconv.Itoa(i) != k {
+			return nil
+		}
+		indices = append(indices, i)
+	}
+	sort.Ints(indices)
+
+	var gaps []indexGap
+	next := 0
+	for _, i := range indices {
+		if i > next {
+			gaps = append(gaps, indexGap{next, i - 1})
+		}
+		next = i + 1
+	}
+	return gaps
+}
+
+// number returns the value of raw if it holds a json number.
+func number(raw *json.RawMessage) (float64, bool) {
+	if raw == nil {
+		return 0, false
+	}
+	switch c := firstByte(*raw); {
+	case c == '-', '0' <= c && c <= '9':
+		n, err := strconv.ParseFloat(string(bytes.TrimSpace(*raw)), 64)
+		return n, err == nil
+	}
+	return 0, false
+}
 
-	// GlobalNullNotPresent will force UnmarshalX to act as if NullNotPresent is
-	// set for every key.
-	GlobalNullNotPresent bool
+// compareNumber compares the number held in raw, which parsed as n, with bound
+// and returns -1, 0, or 1. Rounding to float64 never moves a number past a
+// bound, so raw's text is only parsed exactly when n equals bound, such as for
+// an integer too long for float64 to hold.
+func compareNumber(raw *json.RawMessage, n, bound float64) int {
+	switch {
+	case n < bound:
+		return -1
+	case n > bound:
+		return 1
+	case n != bound:
+		// a NaN bound holds nothing to compare against
+		return 0
+	}
+	exact, ok := new(big.Rat).SetString(string(bytes.TrimSpace(*raw)))
+	if !ok {
+		return 0
+	}
+	return exact.Cmp(new(big.Rat).SetFloat64(bound))
+}
 
-	// FailFast will abort unmarshalling on the first encountered error.
-	FailFast bool
+// canonicalEqual reports if a and b decode to the same value; a nil
+// RawMessage is treated as null.
+func canonicalEqual(a, b *json.RawMessage) bool {
+	var av, bv interface{}
+	if a != nil && json.Unmarshal(*a, &av) != nil {
+		return false
+	}
+	if b != nil && json.Unmarshal(*b, &bv) != nil {
+		return false
+	}
+	return reflect.DeepEqual(av, bv)
+}
 
-	// NullNotPresent is a set of keys that will treat null as an unset value.
-	// The default behavior is that `"key": null` will satisfy key presence for
-	// the Required keys. For keys contained in this set an error would be thrown
-	// instead.
-	NullNotPresent []string
+// -- Path helpers --
 
-	// Required is a set of keys that must be set in the json being unmarshalled.
-	// Any Unmarshal of json containing these keys will return an error if they
-	// are not present.
-	Required []string
+// A docPath locates a value within a document by the segments leading to it
+// from the top. Each segment is an object key or, if index is set, an array
+// index, so that a key which happens to be numeric is still reported as one.
+type docPath []pathSegment
 
-	// Forbidden specifies a set of keys that must *not* be set in the json being
-	// unmarshalled. If they are present they will result in an error.
-	Forbidden []string
+type pathSegment struct {
+	name  string
+	index bool
 }
 
-type builtOptions struct {
-	Options
-	nullNotPresentSet map[string]bool
+// names returns the segments of path as strings, or nil for the top of the
+// document.
+func (path docPath) names() []string {
+	if len(path) == 0 {
+		return nil
+	}
+	names := make([]string, len(path))
+	for i, seg := range path {
+		names[i] = seg.name
+	}
+	return names
 }
 
-func prepareOptions(o Options, v interface{}) builtOptions {
-	bo := builtOptions{o, map[string]bool{}}
-	for _, k := range bo.NullNotPresent {
-		bo.nullNotPresentSet[k] = true
+// last returns the name of the final segment of path, or "" for the top of
+// the document.
+func (path docPath) last() string {
+	if len(path) == 0 {
+		return ""
 	}
-
-	return bo
+	return path[len(path)-1].name
 }
 
-// given a key return if null should be considered a "set" value
-func (bo builtOptions) nullIsPresent(s string) bool {
-	if bo.GlobalNullNotPresent {
-		return false
+// appendPath returns a copy of path with the object keys appended; path itself
+// is never modified so that sibling keys may safely share a prefix.
+func appendPath(path docPath, keys ...string) docPath {
+	p := make(docPath, len(path), len(path)+len(keys))
+	copy(p, path)
+	for _, k := range keys {
+		p = append(p, pathSegment{name: k})
 	}
+	return p
+}
 
-	return !bo.nullNotPresentSet[s]
+// decodedIntoDest reports if the object at path is decoded into the
+// destination itself, being the document or an element of it when it is an
+// array.
+func decodedIntoDest(path docPath) bool {
+	return len(path) == 0 || (len(path) == 1 && path[0].index)
 }
 
-func Unmarshal(data []byte, v interface{}) error {
-	// defer unmarshal calls to UnmarshalX; this will eventually let us take over
-	// unmarshalling of nested structs if appropriate as well as act on struct
-	// tag annotations.
-	return UnmarshalX(data, v, nil)
+// appendIndex returns a copy of path with the array index i appended.
+func appendIndex(path docPath, i int) docPath {
+	p := make(docPath, len(path), len(path)+1)
+	copy(p, path)
+	return append(p, pathSegment{name: strconv.Itoa(i), index: true})
 }
 
-// UnmarshalX reads json from data and stores keys into v while enforcing any
-// Options that were passed in. Passing pcfg as nil will result in no options
-// being applied (i.e. it behaves as json.Unmarshal).
-func UnmarshalX(data []byte, v interface{}, pcfg *Options) error {
-	if pcfg == nil {
-		// eventually we'll still need to UnmarshalX on the children in case they
-		// have options configured
-		return json.Unmarshal(data, v)
+// pointer renders path as an RFC 6901 JSON pointer.
+func pointer(path docPath) string {
+	var buf bytes.Buffer
+	for _, seg := range path {
+		buf.WriteByte('/')
+		buf.WriteString(pointerEscaper.Replace(seg.name))
 	}
+	return buf.String()
+}
 
-	dest := make(map[string]*json.RawMessage)
-	err := json.Unmarshal(data, &dest)
-	if err != nil {
-		return err
+var pointerEscaper = strings.NewReplacer("~", "~0", "/", "~1")
+
+// parsePointer splits an RFC 6901 JSON pointer into its unescaped segments.
+func parsePointer(p string) []string {
+	if p == "" {
+		return nil
+	}
+	segs := strings.Split(strings.TrimPrefix(p, "/"), "/")
+	for i, seg := range segs {
+		segs[i] = pointerUnescaper.Replace(seg)
 	}
+	return segs
+}
 
-	// build interal state
-	cfg := prepareOptions(*pcfg, v)
+var pointerUnescaper = strings.NewReplacer("~1", "/", "~0", "~")
 
-	errors := []ValidationError{}
-	addError := func(ve ValidationError) bool {
-		errors = append(errors, ve)
-		return cfg.FailFast
+func sortedKeys(obj map[string]*json.RawMessage) []string {
+	keys := make([]string, 0, len(obj))
+	for k := range obj {
+		keys = append(keys, k)
 	}
+	sort.Strings(keys)
+	return keys
+}
 
-	present := func(s string) bool {
-		v, ok := dest[s]
-		switch {
-		case !ok:
-			return false
-		case v == nil && cfg.GlobalNullNotPresent:
-			return false
-		case v == nil && !cfg.nullIsPresent(s):
-			return false
-		}
+// isEmptyValue reports if raw is null, an empty string, an empty array, or an
+// empty object.
+func isEmptyValue(raw *json.RawMessage) bool {
+	if raw == nil {
 		return true
 	}
+	v := bytes.TrimSpace(*raw)
+	switch {
+	case len(v) < 2:
+		return false
+	case v[0] == '"':
+		return len(v) == 2
+	case v[0] == '[' || v[0] == '{':
+		return len(bytes.TrimSpace(v[1:len(v)-1])) == 0
+	}
+	return false
+}
+
+// matchesAny reports if s matches any of patterns.
+func matchesAny(patterns []*regexp.Regexp, s string) bool {
+	for _, re := range patterns {
+		if re.MatchString(s) {
+			return true
+		}
+	}
+	return false
+}
 
-	for _, reqKey := range cfg.Required {
-		if !present(reqKey) && addError(ValidationError{MissingKey, reqKey}) {
-			goto done
+// inEnum reports if raw holds a value in allowed. Strings are compared by
+// their contents, ignoring case if fold is set, and other scalars by their
+// json text, such as 1, true, or null; objects and arrays are never allowed.
+func inEnum(raw *json.RawMessage, allowed []string, fold bool) bool {
+	s, str := "null", false
+	if raw != nil {
+		switch jsonKind(*raw) {
+		case "string":
+			if json.Unmarshal(*raw, &s) != nil {
+				return false
+			}
+			str = true
+		case "object", "array":
+			return false
+		default:
+			s = string(bytes.TrimSpace(*raw))
 		}
 	}
+	for _, a := range allowed {
+		if s == a || (fold && str && strings.EqualFold(s, a)) {
+			return true
+		}
+	}
+	return false
+}
+
+// numberTolerance is the relative difference within which AllowedNumbers
+// treats two numbers as equal.
+const numberTolerance = 1e-9
 
-	for _, forbKey := range cfg.Forbidden {
-		if addError(ValidationError{ForbiddenKey, forbKey}) {
-			goto done
+// inNumbers reports if n is within numberTolerance of a number in allowed.
+func inNumbers(n float64, allowed []float64) bool {
+	for _, a := range allowed {
+		if math.Abs(n-a) <= numberTolerance*math.Max(1, math.Max(math.Abs(n), math.Abs(a))) {
+			return true
 		}
 	}
+	return false
+}
 
-done:
-	if len(errors) != 0 {
-		return ErrorCollection{errors}
-	} else {
-		return json.Unmarshal(data, v)
+// joinNumbers lists numbers as they would be written in json.
+func joinNumbers(numbers []float64) string {
+	s := make([]string, len(numbers))
+	for i, n := range numbers {
+		s[i] = strconv.FormatFloat(n, 'g', -1, 64)
+	}
+	return strings.Join(s, ", ")
+}
+
+// jsonKinds holds the names returned by jsonKind which Types may require.
+var jsonKinds = map[string]bool{"string": true, "number": true, "boolean": true, "object": true, "array": true}
+
+// jsonKind names the type of the json value raw, judged by its first byte.
+func jsonKind(raw json.RawMessage) string {
+	switch firstByte(raw) {
+	case '"':
+		return "string"
+	case '{':
+		return "object"
+	case '[':
+		return "array"
+	case 't', 'f':
+		return "boolean"
+	case 'n':
+		return "null"
+	}
+	return "number"
+}
+
+// kindOf is as jsonKind but also accepts the nil used for null values.
+func kindOf(raw *json.RawMessage) string {
+	if raw == nil {
+		return "null"
+	}
+	return jsonKind(*raw)
+}
+
+// jsonType is as jsonKind but with an article for use in messages.
+func jsonType(raw json.RawMessage) string {
+	switch k := jsonKind(raw); k {
+	case "null":
+		return k
+	case "object", "array":
+		return "an " + k
+	default:
+		return "a " + k
 	}
-	return nil
+}
+
+// firstByte returns the first non-whitespace byte of a json value, or 0 if
+// there is none.
+func firstByte(raw []byte) byte {
+	raw = bytes.TrimLeft(raw, " \t\r\n")
+	if len(raw) == 0 {
+		return 0
+	}
+	return raw[0]
 }
 
 // -- Error types --
@@ -152,7 +2832,8 @@ done:
 // ErrorCollection is a set of errors that were encountered when enforcing the
 // requested unmarshal options.
 type ErrorCollection struct {
-	errors []ValidationError
+	errors    []ValidationError
+	truncated bool
 }
 
 var _ error = ErrorCollection{}
@@ -162,7 +2843,64 @@ func (e ErrorCollection) Error() string {
 	for i, ele := range e.errors {
 		s[i] = ele.Error()
 	}
-	return fmt.Sprintf("['%s']", strings.Join(s, "', '"))
+	msg := fmt.Sprintf("['%s']", strings.Join(s, "', '"))
+	if e.truncated {
+		msg += fmt.Sprintf(" (stopped after %d errors)", len(e.errors))
+	}
+	return msg
+}
+
+// Truncated reports if validation stopped early because it reached
+// Options.MaxErrors, in which case the input may have more problems than the
+// collection holds.
+func (e ErrorCollection) Truncated() bool {
+	return e.truncated
+}
+
+// First returns the first error of type t in the collection, if any.
+func (e ErrorCollection) First(t ValidationErrorType) (ValidationError, bool) {
+	for _, ve := range e.errors {
+		if ve.Type == t {
+			return ve, true
+		}
+	}
+	return ValidationError{}, false
+}
+
+// Errors returns a copy of the errors in the collection, in order.
+func (e ErrorCollection) Errors() []ValidationError {
+	return append([]ValidationError(nil), e.errors...)
+}
+
+// Unwrap returns the errors in the collection, in order, so that errors.Is and
+// errors.As can match any of them.
+func (e ErrorCollection) Unwrap() []error {
+	errs := make([]error, len(e.errors))
+	for i, ve := range e.errors {
+		errs[i] = ve
+	}
+	return errs
+}
+
+// WalkErrors calls fn for each error in the collection, in order, stopping
+// early if fn returns false.
+func (e ErrorCollection) WalkErrors(fn func(ValidationError) bool) {
+	for _, ve := range e.errors {
+		if !fn(ve) {
+			return
+		}
+	}
+}
+
+// ConfigError reports Options which are invalid or contradict themselves.
+type ConfigError struct {
+	Reason string
+}
+
+var _ error = ConfigError{}
+
+func (ce ConfigError) Error() string {
+	return fmt.Sprintf("invalid options: %s", ce.Reason)
 }
 
 // ValidationErrorType specifies which type of validation error was encountered
@@ -171,36 +2909,429 @@ type ValidationErrorType int
 const (
 	MissingKey ValidationErrorType = iota
 	ForbiddenKey
+	LengthViolation
+	ComparisonFailed
+	OutOfRange
+	AtLeastNOf
+	EmptyInput
+	InvalidString
+	AliasCollision
+	InvalidKey
+	SuppressedErrors
+	NonFiniteNumber
+	DecodeError
+	InvalidNumber
+	OutOfOrder
+	BudgetExceeded
+	UnknownKey
+	MixedTypes
+	NullNotAllowed
+	InvalidEnum
+	TypeMismatch
+	PatternMismatch
+	RoundTripMismatch
+	DuplicateKey
+	ConflictingKeys
+	MissingGroup
+	NotInEnum
 )
 
+var validationErrorTypeNames = map[ValidationErrorType]string{
+	MissingKey:        "MissingKey",
+	ForbiddenKey:      "ForbiddenKey",
+	LengthViolation:   "LengthViolation",
+	ComparisonFailed:  "ComparisonFailed",
+	OutOfRange:        "OutOfRange",
+	AtLeastNOf:        "AtLeastNOf",
+	EmptyInput:        "EmptyInput",
+	InvalidString:     "InvalidString",
+	AliasCollision:    "AliasCollision",
+	InvalidKey:        "InvalidKey",
+	SuppressedErrors:  "SuppressedErrors",
+	NonFiniteNumber:   "NonFiniteNumber",
+	DecodeError:       "DecodeError",
+	InvalidNumber:     "InvalidNumber",
+	OutOfOrder:        "OutOfOrder",
+	BudgetExceeded:    "BudgetExceeded",
+	UnknownKey:        "UnknownKey",
+	MixedTypes:        "MixedTypes",
+	NullNotAllowed:    "NullNotAllowed",
+	InvalidEnum:       "InvalidEnum",
+	TypeMismatch:      "TypeMismatch",
+	PatternMismatch:   "PatternMismatch",
+	RoundTripMismatch: "RoundTripMismatch",
+	DuplicateKey:      "DuplicateKey",
+	ConflictingKeys:   "ConflictingKeys",
+	MissingGroup:      "MissingGroup",
+	NotInEnum:         "NotInEnum",
+}
+
+func (t ValidationErrorType) String() string {
+	if name, ok := validationErrorTypeNames[t]; ok {
+		return name
+	}
+	return fmt.Sprintf("ValidationErrorType(%d)", int(t))
+}
+
 // ValidationError is a binds together a ValidationErrorType and the key that
 // failed to validate in the appropriate way.
 type ValidationError struct {
 	Type ValidationErrorType
-	Key  string
+
+	// Key is the dotted path to the offending key from the top of the
+	// document, such as "servers[2].host". Only array indices are written in
+	// brackets; an integer object key is dotted like any other, so the key
+	// "5" in {"a": {"5": 1}} is "a.5". Errors that concern several keys at
+	// once name them after the enclosing object's path, such as
+	// "server.user,token".
+	Key string
+
+	// Path is the JSON pointer (RFC 6901) to the offending key, e.g.
+	// "/server/password". Errors that concern several keys at once point to
+	// the object containing them instead.
+	Path string
+
+	// PathSegments holds the unescaped segments of Path, for consumers that
+	// would otherwise need to parse the pointer.
+	PathSegments []string
+
+	// Detail holds any rule specific context for the failure, such as the
+	// bound that was exceeded.
+	Detail string
+
+	// Value holds the raw value of a forbidden key when CaptureForbiddenValues
+	// is set, for auditing what a client attempted to set. Error includes it,
+	// truncated if long. It is empty for other errors.
+	Value json.RawMessage
+}
+
+// newError returns a ValidationError of type t for key, which is located at
+// path within the document.
+func newError(t ValidationErrorType, key string, path docPath) ValidationError {
+	return ValidationError{Type: t, Key: fullKey(key, path), Path: pointer(path), PathSegments: path.names()}
+}
+
+// fullKey returns the Key reported for an error concerning key at path: the
+// dotted path to it from the top of the document. key usually names the last
+// segments of path, but errors concerning several keys at once are located at
+// their enclosing object.
+func fullKey(key string, path docPath) string {
+	if len(path) > 0 && path.last() == key {
+		return dottedPath(path)
+	}
+	if n := strings.Count(key, ".") + 1; n > 1 && len(path) >= n && strings.Join(path[len(path)-n:].names(), ".") == key {
+		return dottedPath(path)
+	}
+	if len(path) == 0 {
+		return key
+	}
+	return dottedPath(path) + "." + key
+}
+
+// ruleKey returns the key ve was reported for without the path leading to it,
+// so that errors for the same key in different objects are grouped together.
+func ruleKey(ve ValidationError) string {
+	if len(ve.PathSegments) == 0 {
+		return ve.Key
+	}
+	rest := ve.Key
+	for i, seg := range ve.PathSegments {
+		switch {
+		case strings.HasPrefix(rest, "["+seg+"]"):
+			rest = rest[len(seg)+2:]
+		case i == 0 && strings.HasPrefix(rest, seg):
+			rest = rest[len(seg):]
+		case i > 0 && strings.HasPrefix(rest, "."+seg):
+			rest = rest[len(seg)+1:]
+		default:
+			rest = ""
+		}
+	}
+	if strings.HasPrefix(rest, ".") {
+		return rest[1:]
+	}
+	return ve.PathSegments[len(ve.PathSegments)-1]
+}
+
+// dottedPath renders path as a dotted path such as "servers[2].host", with
+// array indices in brackets.
+func dottedPath(path docPath) string {
+	var buf strings.Builder
+	for _, seg := range path {
+		switch {
+		case seg.index:
+			buf.WriteString("[" + seg.name + "]")
+		case buf.Len() > 0:
+			buf.WriteString("." + seg.name)
+		default:
+			buf.WriteString(seg.name)
+		}
+	}
+	return buf.String()
+}
+
+// isIndex reports if seg is written as a non-negative integer, as array
+// indices in a path are.
+func isIndex(seg string) bool {
+	i, err := strconv.Atoi(seg)
+	return err == nil && i >= 0 && strconv.Itoa(i) == seg
+}
+
+// NewValidationError returns a ValidationError of type t for the key located
+// by the JSON pointer path, e.g. "/server/host", as the validation in this
+// package would report it. A pointer doesn't say which segments are array
+// indices, so numeric segments are taken to be: NewMissingKeyError("/a/0") has
+// the Key "a[0]", which won't equal the error validation reports for an
+// integer object key, "a.0".
+func NewValidationError(t ValidationErrorType, path, detail string) ValidationError {
+	var p docPath
+	for _, seg := range parsePointer(path) {
+		p = append(p, pathSegment{name: seg, index: isIndex(seg)})
+	}
+	ve := newError(t, p.last(), p)
+	ve.Detail = detail
+	return ve
+}
+
+// NewMissingKeyError returns a MissingKey error for the key at path.
+func NewMissingKeyError(path string) ValidationError {
+	return NewValidationError(MissingKey, path, "")
+}
+
+// NewForbiddenKeyError returns a ForbiddenKey error for the key at path.
+func NewForbiddenKeyError(path string) ValidationError {
+	return NewValidationError(ForbiddenKey, path, "")
 }
 
 var _ error = ValidationError{}
 
+// Sentinels matched by ValidationErrors of the corresponding type, so that
+// errors.Is(err, ErrMissingKey) reports if decoding failed for a missing key.
+var (
+	ErrMissingKey   = errors.New("missing key")
+	ErrForbiddenKey = errors.New("forbidden key")
+)
+
+var validationErrorSentinels = map[ValidationErrorType]error{
+	MissingKey:   ErrMissingKey,
+	ForbiddenKey: ErrForbiddenKey,
+}
+
+// Is reports if target is the sentinel for ve's type, such as ErrMissingKey.
+func (ve ValidationError) Is(target error) bool {
+	sentinel, ok := validationErrorSentinels[ve.Type]
+	return ok && target == sentinel
+}
+
 func (ve ValidationError) Error() string {
-	if ve.Type == MissingKey {
-		return missingKey(ve.Key)
+	msg := ve.message()
+	if len(ve.Value) != 0 {
+		msg = fmt.Sprintf("%s with value %s", msg, truncateValue(ve.Value))
+	}
+	// Key holds the full path to the error when there is one
+	if ve.Key == "" && ve.Path != "" {
+		msg = fmt.Sprintf("%s at %s", msg, ve.Path)
+	}
+	return msg
+}
+
+// maxErrorValueLen bounds how many bytes of a ValidationError's Value are
+// included in its message.
+const maxErrorValueLen = 32
+
+// truncateValue returns v for use in an error message, cut short if it is
+// longer than maxErrorValueLen without splitting a multi-byte character.
+func truncateValue(v json.RawMessage) string {
+	if len(v) <= maxErrorValueLen {
+		return string(v)
 	}
-	if ve.Type == ForbiddenKey {
+	n := maxErrorValueLen
+	for n > 0 && !utf8.RuneStart(v[n]) {
+		n--
+	}
+	return string(v[:n]) + "..."
+}
+
+func (ve ValidationError) message() string {
+	switch ve.Type {
+	case MissingKey:
+		return missingKey(ve.Key, ve.Detail)
+	case ForbiddenKey:
 		return forbiddenKey(ve.Key)
+	case LengthViolation:
+		return lengthViolation(ve.Key, ve.Detail)
+	case ComparisonFailed:
+		return comparisonFailed(ve.Key)
+	case OutOfRange:
+		return outOfRange(ve.Key, ve.Detail)
+	case AtLeastNOf:
+		return atLeastNOf(ve.Key, ve.Detail)
+	case EmptyInput:
+		return emptyInput()
+	case InvalidString:
+		return invalidString(ve.Key, ve.Detail)
+	case AliasCollision:
+		return aliasCollision(ve.Key, ve.Detail)
+	case InvalidKey:
+		return invalidKey(ve.Key, ve.Detail)
+	case SuppressedErrors:
+		return ve.Detail
+	case NonFiniteNumber:
+		return nonFiniteNumber(ve.Key, ve.Detail)
+	case DecodeError:
+		return decodeError(ve.Detail)
+	case InvalidNumber:
+		return invalidNumber(ve.Key, ve.Detail)
+	case OutOfOrder:
+		return outOfOrder(ve.Key, ve.Detail)
+	case BudgetExceeded:
+		return budgetExceeded(ve.Detail)
+	case UnknownKey:
+		return unknownKey(ve.Key, ve.Detail)
+	case MixedTypes:
+		return mixedTypes(ve.Key, ve.Detail)
+	case NullNotAllowed:
+		return nullNotAllowed(ve.Key)
+	case InvalidEnum:
+		return invalidEnum(ve.Key, ve.Detail)
+	case TypeMismatch:
+		return typeMismatch(ve.Key, ve.Detail)
+	case PatternMismatch:
+		return patternMismatch(ve.Key, ve.Detail)
+	case RoundTripMismatch:
+		return roundTripMismatch(ve.Detail)
+	case DuplicateKey:
+		return duplicateKey(ve.Key, ve.Detail)
+	case ConflictingKeys:
+		return conflictingKeys(ve.Key, ve.Detail)
+	case MissingGroup:
+		return missingGroup(ve.Key)
+	case NotInEnum:
+		return notInEnum(ve.Key, ve.Detail)
 	}
 
 	return fmt.Sprintf("unexpected error type %d for key <%s>", ve.Type, ve.Key)
 }
 
-func missingKey(s string) string {
+func missingKey(s, detail string) string {
+	if detail != "" {
+		return fmt.Sprintf("required key <%s> was %s", s, detail)
+	}
 	return fmt.Sprintf("required key <%s> not found", s)
 }
 
+func nullNotAllowed(s string) string {
+	return fmt.Sprintf("required key <%s> was null", s)
+}
+
 func forbiddenKey(s string) string {
 	return fmt.Sprintf("forbidden key <%s> was set", s)
 }
 
+func comparisonFailed(s string) string {
+	return fmt.Sprintf("keys <%s> do not hold equal values", s)
+}
+
+func outOfRange(s, detail string) string {
+	return fmt.Sprintf("key <%s> is out of range: %s", s, detail)
+}
+
+func atLeastNOf(s, detail string) string {
+	return fmt.Sprintf("not enough of keys <%s> were set: %s", s, detail)
+}
+
+func emptyInput() string {
+	return "input was empty"
+}
+
+func invalidString(s, detail string) string {
+	return fmt.Sprintf("key <%s> holds an invalid string: %s", s, detail)
+}
+
+func aliasCollision(s, detail string) string {
+	return fmt.Sprintf("alias <%s> was ignored: %s", s, detail)
+}
+
+func unknownKey(s, detail string) string {
+	if detail != "" {
+		return fmt.Sprintf("unknown key <%s> is not a field of the destination: %s", s, detail)
+	}
+	return fmt.Sprintf("unknown key <%s> is not a field of the destination", s)
+}
+
+func mixedTypes(s, detail string) string {
+	return fmt.Sprintf("array <%s> mixes element types: %s", s, detail)
+}
+
+func invalidEnum(s, detail string) string {
+	return fmt.Sprintf("key <%s> has a value not in the allowed set: %s", s, detail)
+}
+
+func typeMismatch(s, detail string) string {
+	if s == "" {
+		return fmt.Sprintf("document has the wrong type: %s", detail)
+	}
+	return fmt.Sprintf("key <%s> has the wrong type: %s", s, detail)
+}
+
+func patternMismatch(s, detail string) string {
+	return fmt.Sprintf("key <%s> does not match the required pattern: %s", s, detail)
+}
+
+func conflictingKeys(s, detail string) string {
+	return fmt.Sprintf("only one of keys <%s> may be set: %s", s, detail)
+}
+
+func missingGroup(s string) string {
+	return fmt.Sprintf("none of keys <%s> were set", s)
+}
+
+func notInEnum(s, detail string) string {
+	return fmt.Sprintf("key <%s> is not one of the allowed values: %s", s, detail)
+}
+
+func duplicateKey(s, detail string) string {
+	if detail != "" {
+		return fmt.Sprintf("key <%s> appears more than once: %s", s, detail)
+	}
+	return fmt.Sprintf("key <%s> appears more than once", s)
+}
+
+func roundTripMismatch(detail string) string {
+	if detail != "" {
+		return fmt.Sprintf("decoded value does not round trip to the input: %s", detail)
+	}
+	return "decoded value does not round trip to the input"
+}
+
+func invalidKey(s, detail string) string {
+	return fmt.Sprintf("key <%s> is not a valid key name: %s", s, detail)
+}
+
+func nonFiniteNumber(s, detail string) string {
+	return fmt.Sprintf("field <%s> holds a non-finite number: %s", s, detail)
+}
+
+func decodeError(detail string) string {
+	return fmt.Sprintf("invalid json: %s", detail)
+}
+
+func invalidNumber(s, detail string) string {
+	return fmt.Sprintf("key <%s> holds an invalid number: %s", s, detail)
+}
+
+func outOfOrder(s, detail string) string {
+	return fmt.Sprintf("key <%s> is out of order: %s", s, detail)
+}
+
+func budgetExceeded(detail string) string {
+	return fmt.Sprintf("validation budget exhausted: %s", detail)
+}
+
+func lengthViolation(s, detail string) string {
+	return fmt.Sprintf("key <%s> has an invalid length: %s", s, detail)
+}
+
 // -- defer everything except unmarshal to the default library --
 
 func Compact(dst *bytes.Buffer, src []byte) error {
@@ -215,10 +3346,155 @@ func Indent(dst *bytes.Buffer, src []byte, prefix, indent string) error {
 	return json.Indent(dst, src, prefix, indent)
 }
 
+// Marshal returns the json encoding of v as json.Marshal does, subject to the
+// package-wide Config.
 func Marshal(v interface{}) ([]byte, error) {
-	return json.Marshal(v)
+	return marshal(v, "", "")
 }
 
+// MarshalIndent is as Marshal but indents the output as json.MarshalIndent
+// does.
 func MarshalIndent(v interface{}, prefix, indent string) ([]byte, error) {
-	return json.MarshalIndent(v, prefix, indent)
+	return marshal(v, prefix, indent)
+}
+
+// MarshalX returns the json encoding of v after validating it against pcfg as
+// UnmarshalX would validate input, so that a value about to be sent can be
+// checked against the keys a recipient requires. On validation failure the
+// ErrorCollection is returned and no bytes. Options that rewrite the document,
+// such as StripNulls or Canonicalize, are applied to the returned encoding.
+// v is encoded honoring the package-wide Config, as by Marshal.
+func MarshalX(v interface{}, pcfg *Options) ([]byte, error) {
+	if pcfg != nil && len(pcfg.RequireNonEmptyOnMarshal) != 0 {
+		vd := validator{cfg: builtOptions{Options: *pcfg}}
+		for _, k := range pcfg.RequireNonEmptyOnMarshal {
+			if !nonEmpty(fieldValue(reflect.ValueOf(v), k)) && vd.addError(newError(MissingKey, k, appendPath(nil, k))) {
+				break
+			}
+		}
+		if _, err := vd.result(); err != nil {
+			return nil, err
+		}
+	}
+
+	data, err := marshal(v, "", "")
+	if err != nil || pcfg == nil {
+		return data, err
+	}
+
+	// validation ends by decoding the document, which here is only used to
+	// capture it after any rewriting
+	cfg := *pcfg
+	cfg.Decode = func(out []byte, _ interface{}) error {
+		data = out
+		return nil
+	}
+	cfg.OnSuccess = nil
+	if _, err := UnmarshalWithResult(data, v, &cfg); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// fieldValue returns the value rv would encode at key, following pointers and
+// interfaces to a struct, including fields promoted from embedded structs,
+// or to a map with string keys. It returns the zero Value if there is none.
+func fieldValue(rv reflect.Value, key string) reflect.Value {
+	for rv.Kind() == reflect.Ptr || rv.Kind() == reflect.Interface {
+		if rv.IsNil() {
+			return reflect.Value{}
+		}
+		rv = rv.Elem()
+	}
+
+	switch rv.Kind() {
+	case reflect.Map:
+		if rv.Type().Key().Kind() == reflect.String {
+			return rv.MapIndex(reflect.ValueOf(key).Convert(rv.Type().Key()))
+		}
+	case reflect.Struct:
+		// fields of the struct itself take precedence over promoted ones
+		var embedded []int
+		for i := 0; i < rv.NumField(); i++ {
+			f := rv.Type().Field(i)
+			if f.Anonymous && !hasJSONName(f) && f.Tag.Get("json") != "-" {
+				ft := f.Type
+				if ft.Kind() == reflect.Ptr {
+					ft = ft.Elem()
+				}
+				if ft.Kind() == reflect.Struct {
+					embedded = append(embedded, i)
+					continue
+				}
+			}
+			if name, ok := fieldName(f); ok && !(f.Anonymous && f.PkgPath != "") && name == key {
+				return rv.Field(i)
+			}
+		}
+		for _, i := range embedded {
+			if fv := fieldValue(rv.Field(i), key); fv.IsValid() {
+				return fv
+			}
+		}
+	}
+	return reflect.Value{}
+}
+
+// nonEmpty reports if rv holds a value other than its zero value, or for
+// strings, slices, and maps one of non-zero length. Interfaces are judged by
+// the value they hold.
+func nonEmpty(rv reflect.Value) bool {
+	for rv.Kind() == reflect.Interface && !rv.IsNil() {
+		rv = rv.Elem()
+	}
+	if !rv.IsValid() {
+		return false
+	}
+	switch rv.Kind() {
+	case reflect.String, reflect.Slice, reflect.Map:
+		return rv.Len() != 0
+	}
+	return !rv.IsZero()
+}
+
+// IndentValidated validates data and decodes it into v as UnmarshalX would
+// and, on success, returns data indented as by json.Indent. On failure the
+// error from UnmarshalX, such as an ErrorCollection, is returned and no bytes.
+// The input is indented as given; options that rewrite the document, such as
+// StripNulls, only affect what is decoded into v.
+func IndentValidated(data []byte, v interface{}, opts *Options, prefix, indent string) ([]byte, error) {
+	if err := UnmarshalX(data, v, opts); err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	if err := json.Indent(&buf, data, prefix, indent); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// MarshalCanonical returns the json encoding of v with the keys of every
+// object, struct fields included, sorted lexicographically and without
+// insignificant whitespace. The output is stable for equal values which makes
+// it suitable for hashing or signing.
+func MarshalCanonical(v interface{}) ([]byte, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return canonicalize(data)
+}
+
+// canonicalize re-encodes the json document in data in canonical form. Numbers
+// are carried through as json.Number so that they keep their original text.
+func canonicalize(data []byte) ([]byte, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+
+	var doc interface{}
+	if err := dec.Decode(&doc); err != nil {
+		return nil, err
+	}
+	return json.Marshal(doc)
 }
@@ -1,9 +1,16 @@
 package json
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"math"
 	"reflect"
+	"strings"
 	"testing"
+	"time"
 )
 
 func init() {
@@ -47,6 +54,19 @@ func noErr(t *testing.T, err error) {
 	}
 }
 
+// testErrors asserts that e is an ErrorCollection holding exactly want.
+func testErrors(t *testing.T, e error, want ...ValidationError) {
+	err, ok := e.(ErrorCollection)
+	if !ok {
+		t.Errorf("got: %T, %#v, want: ErrorCollection", e, e)
+		return
+	}
+
+	if !reflect.DeepEqual(err.errors, want) {
+		t.Errorf("got: %#v, want: %#v", err.errors, want)
+	}
+}
+
 func TestUnmarshalXNoOpts(t *testing.T) {
 	o := TestStruct{}
 	err := UnmarshalX(tsEncoded, &o, &Options{})
@@ -67,8 +87,8 @@ func TestUnmarshalXRejectBar(t *testing.T) {
 		t.Errorf("got: %T, %#v, want: ErrorCollection", e, e)
 	}
 
-	want := ErrorCollection{[]ValidationError{
-		{ForbiddenKey, "bar"},
+	want := ErrorCollection{errors: []ValidationError{
+		{Type: ForbiddenKey, Key: "bar", Path: "/bar", PathSegments: []string{"bar"}},
 	}}
 	if !reflect.DeepEqual(err, want) {
 		t.Errorf("got: %#v, want: %#v", err, want)
@@ -91,9 +111,9 @@ func TestUnmarshalXRejectBarRequireFoo(t *testing.T) {
 		t.Errorf("got: %T, %#v, want: ErrorCollection", e, e)
 	}
 
-	want := ErrorCollection{[]ValidationError{
-		{MissingKey, "foo"},
-		{ForbiddenKey, "bar"},
+	want := ErrorCollection{errors: []ValidationError{
+		{Type: MissingKey, Key: "foo", Path: "/foo", PathSegments: []string{"foo"}},
+		{Type: ForbiddenKey, Key: "bar", Path: "/bar", PathSegments: []string{"bar"}},
 	}}
 	if !reflect.DeepEqual(err, want) {
 		t.Errorf("got: %#v, want: %#v", err, want)
@@ -116,7 +136,7 @@ func TestUnmarshalXRejectBarRequireFooFailFast(t *testing.T) {
 		t.Errorf("got: %T, %#v, want: ErrorCollection", e, e)
 	}
 
-	want := ErrorCollection{[]ValidationError{{MissingKey, "foo"}}}
+	want := ErrorCollection{errors: []ValidationError{{Type: MissingKey, Key: "foo", Path: "/foo", PathSegments: []string{"foo"}}}}
 	if !reflect.DeepEqual(err, want) {
 		t.Errorf("got: %#v, want: %#v", err, want)
 	}
@@ -139,7 +159,7 @@ func TestUnmarshalXNullNotPresent(t *testing.T) {
 		return
 	}
 
-	want := ErrorCollection{[]ValidationError{{MissingKey, "foo"}}}
+	want := ErrorCollection{errors: []ValidationError{{Type: MissingKey, Key: "foo", Path: "/foo", PathSegments: []string{"foo"}}}}
 	if !reflect.DeepEqual(err, want) {
 		t.Errorf("got: %#v, want: %#v", err, want)
 	}
@@ -163,11 +183,2152 @@ func TestUnmarshalXGlobalNullNotPresentForbiddenNoFailFast(t *testing.T) {
 		return
 	}
 
-	want := ErrorCollection{[]ValidationError{
-		{MissingKey, "foo"},
-		{ForbiddenKey, "bar"},
+	want := ErrorCollection{errors: []ValidationError{
+		{Type: MissingKey, Key: "foo", Path: "/foo", PathSegments: []string{"foo"}},
+		{Type: ForbiddenKey, Key: "bar", Path: "/bar", PathSegments: []string{"bar"}},
 	}}
 	if !reflect.DeepEqual(err, want) {
 		t.Errorf("got: %#v, want: %#v", err, want)
 	}
 }
+
+var nestedEncoded = []byte(`{
+  "foo": "foo",
+  "outer": {
+    "inner": {"password": "hunter2"},
+    "list": [{"foo": "a"}, {"password": "swordfish"}]
+  }
+}`)
+
+func TestUnmarshalXApplyRecursivelyForbidden(t *testing.T) {
+	o := TestStruct{}
+	cfg := &Options{ApplyRecursively: true, Forbidden: []string{"password"}}
+
+	e := UnmarshalX(nestedEncoded, &o, cfg)
+	testErrors(t, e,
+		ValidationError{Type: ForbiddenKey, Key: "outer.inner.password", Path: "/outer/inner/password", PathSegments: []string{"outer", "inner", "password"}},
+		ValidationError{Type: ForbiddenKey, Key: "outer.list[1].password", Path: "/outer/list/1/password", PathSegments: []string{"outer", "list", "1", "password"}},
+	)
+}
+
+func TestUnmarshalXForbiddenNotRecursive(t *testing.T) {
+	o := TestStruct{}
+	e := UnmarshalX(nestedEncoded, &o, &Options{Forbidden: []string{"password"}})
+	noErr(t, e)
+	testTS(t, o, TestStruct{Foo: "foo"})
+}
+
+func TestUnmarshalXApplyRecursivelyFailFast(t *testing.T) {
+	o := TestStruct{}
+	cfg := &Options{
+		ApplyRecursively: true,
+		FailFast:         true,
+		Forbidden:        []string{"password"},
+	}
+
+	e := UnmarshalX(nestedEncoded, &o, cfg)
+	testErrors(t, e,
+		ValidationError{Type: ForbiddenKey, Key: "outer.inner.password", Path: "/outer/inner/password", PathSegments: []string{"outer", "inner", "password"}},
+	)
+}
+
+func TestPointerEscaping(t *testing.T) {
+	got := pointer(appendPath(nil, "a/b", "c~d", "e"))
+	if want := "/a~1b/c~0d/e"; got != want {
+		t.Errorf("got: %v, want: %v", got, want)
+	}
+}
+
+func TestUnmarshalXStripNulls(t *testing.T) {
+	input := []byte(`{"foo": null, "bar": 4444}`)
+	o := TestStruct{Foo: "default"}
+
+	err := UnmarshalX(input, &o, &Options{StripNulls: true})
+	noErr(t, err)
+	testTS(t, o, TestStruct{"default", ts.Bar})
+}
+
+func TestUnmarshalXStripNullsRecursive(t *testing.T) {
+	input := []byte(`{"a": {"b": null, "c": 1, "d": [{"e": null}, null]}, "f": null}`)
+
+	var got map[string]interface{}
+	err := UnmarshalX(input, &got, &Options{StripNulls: true, ApplyRecursively: true})
+	noErr(t, err)
+
+	want := map[string]interface{}{
+		"a": map[string]interface{}{
+			"c": float64(1),
+			"d": []interface{}{map[string]interface{}{}, nil},
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got: %#v, want: %#v", got, want)
+	}
+}
+
+func TestUnmarshalXStripNullsTopLevelOnly(t *testing.T) {
+	input := []byte(`{"a": {"b": null}, "f": null}`)
+
+	var got map[string]interface{}
+	err := UnmarshalX(input, &got, &Options{StripNulls: true})
+	noErr(t, err)
+
+	want := map[string]interface{}{"a": map[string]interface{}{"b": nil}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got: %#v, want: %#v", got, want)
+	}
+}
+
+func TestErrorCollectionFirst(t *testing.T) {
+	errs := ErrorCollection{errors: []ValidationError{
+		{Type: ForbiddenKey, Key: "bar", Path: "/bar", PathSegments: []string{"bar"}},
+		{Type: MissingKey, Key: "foo", Path: "/foo", PathSegments: []string{"foo"}},
+		{Type: MissingKey, Key: "baz", Path: "/baz", PathSegments: []string{"baz"}},
+	}}
+
+	got, ok := errs.First(MissingKey)
+	want := ValidationError{Type: MissingKey, Key: "foo", Path: "/foo", PathSegments: []string{"foo"}}
+	if !ok || !reflect.DeepEqual(got, want) {
+		t.Errorf("got: %#v, %v, want: %#v, true", got, ok, want)
+	}
+
+	if got, ok := (ErrorCollection{}).First(MissingKey); ok {
+		t.Errorf("got: %#v, %v, want: false", got, ok)
+	}
+}
+
+func TestUnmarshalXMaxErrors(t *testing.T) {
+	cfg := &Options{Required: []string{"a", "b", "c", "d"}, MaxErrors: 2}
+
+	var o map[string]interface{}
+	e := UnmarshalX([]byte(`{}`), &o, cfg)
+	testErrors(t, e, NewMissingKeyError("/a"), NewMissingKeyError("/b"))
+	if ec := e.(ErrorCollection); !ec.Truncated() {
+		t.Errorf("got: %#v, want: a truncated collection", ec)
+	}
+	if got, want := e.Error(), "['required key <a> not found', 'required key <b> not found'] (stopped after 2 errors)"; got != want {
+		t.Errorf("got: %q, want: %q", got, want)
+	}
+
+	res, _ := UnmarshalWithResult([]byte(`{}`), &o, cfg)
+	if !res.ShortCircuited {
+		t.Errorf("got: %#v, want: ShortCircuited", res)
+	}
+
+	cfg.MaxErrors = 0
+	e = UnmarshalX([]byte(`{"a": 1}`), &o, cfg)
+	testErrors(t, e, NewMissingKeyError("/b"), NewMissingKeyError("/c"), NewMissingKeyError("/d"))
+	if e.(ErrorCollection).Truncated() {
+		t.Errorf("got: %v, want: a complete collection", e)
+	}
+}
+
+func TestErrorCollectionErrors(t *testing.T) {
+	errs := ErrorCollection{errors: []ValidationError{NewForbiddenKeyError("/bar"), NewMissingKeyError("/foo")}}
+
+	got := errs.Errors()
+	if want := []ValidationError{NewForbiddenKeyError("/bar"), NewMissingKeyError("/foo")}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got: %#v, want: %#v", got, want)
+	}
+
+	// the returned slice doesn't alias the collection
+	got[0] = NewMissingKeyError("/baz")
+	if errs.errors[0].Type != ForbiddenKey {
+		t.Errorf("got: %#v, want: the collection to be unchanged", errs.errors[0])
+	}
+
+	if got := (ErrorCollection{}).Errors(); len(got) != 0 {
+		t.Errorf("got: %#v, want: no errors", got)
+	}
+}
+
+func TestErrorCollectionIs(t *testing.T) {
+	var o map[string]interface{}
+	err := fmt.Errorf("decoding request: %w",
+		UnmarshalX([]byte(`{"bar": 1}`), &o, &Options{Required: []string{"foo"}}))
+
+	var ec ErrorCollection
+	if !errors.As(err, &ec) || len(ec.errors) != 1 {
+		t.Errorf("got: %#v, want: an ErrorCollection holding one error", ec)
+	}
+	var ve ValidationError
+	if !errors.As(err, &ve) || ve.Type != MissingKey {
+		t.Errorf("got: %#v, want: a MissingKey error", ve)
+	}
+	if !errors.Is(err, ErrMissingKey) {
+		t.Errorf("got: errors.Is(%v, ErrMissingKey) false, want: true", err)
+	}
+	if errors.Is(err, ErrForbiddenKey) {
+		t.Errorf("got: errors.Is(%v, ErrForbiddenKey) true, want: false", err)
+	}
+}
+
+func TestUnmarshalXMaxItemsDeep(t *testing.T) {
+	input := []byte(`{
+  "small": [1, 2],
+  "outer": {"inner": [[1, 2, 3, 4], [5]]}
+}`)
+
+	var o map[string]interface{}
+	e := UnmarshalX(input, &o, &Options{MaxItemsDeep: 3})
+	testErrors(t, e, ValidationError{
+		Type:         LengthViolation,
+		Key:          "outer.inner[0]",
+		Path:         "/outer/inner/0",
+		PathSegments: []string{"outer", "inner", "0"},
+		Detail:       "4 items exceeds the maximum of 3",
+	})
+}
+
+func TestUnmarshalXMaxItemsBeforeDecode(t *testing.T) {
+	cfg := &Options{MaxItemsBeforeDecode: map[string]int{"items": 3, "name": 1}}
+
+	var o struct {
+		Items []int
+		Name  string
+	}
+	noErr(t, UnmarshalX([]byte(`{"items": [1, 2, 3], "name": "long"}`), &o, cfg))
+
+	o.Items = nil
+	input := []byte(`{"items": [` + strings.Repeat("1,", 100000) + `1]}`)
+	testErrors(t, UnmarshalX(input, &o, cfg),
+		NewValidationError(LengthViolation, "/items", "more than 3 items"))
+	if o.Items != nil {
+		t.Errorf("got: %d items, want: nothing decoded", len(o.Items))
+	}
+}
+
+func TestUnmarshalXMaxItemsDeepRootArray(t *testing.T) {
+	var o []map[string]interface{}
+	e := UnmarshalX([]byte(`[{}, {}, {}, {}, {}]`), &o, &Options{MaxItemsDeep: 2})
+	testErrors(t, e, NewValidationError(LengthViolation, "", "5 items exceeds the maximum of 2"))
+
+	noErr(t, UnmarshalX([]byte(`[{}, {}]`), &o, &Options{MaxItemsDeep: 2}))
+}
+
+func TestUnmarshalXMaxItemsDeepWithinLimit(t *testing.T) {
+	input := []byte(`{"outer": {"inner": [[1, 2, 3], [4]]}}`)
+
+	var o map[string]interface{}
+	noErr(t, UnmarshalX(input, &o, &Options{MaxItemsDeep: 3}))
+}
+
+func TestUnmarshalXFieldEquals(t *testing.T) {
+	cfg := &Options{FieldEquals: [][2]string{{"password", "password_confirm"}}}
+
+	var o map[string]interface{}
+	input := []byte(`{"password": "hunter2", "password_confirm":"hunter2"}`)
+	noErr(t, UnmarshalX(input, &o, cfg))
+
+	input = []byte(`{"password": "hunter2", "password_confirm": "hunter3"}`)
+	e := UnmarshalX(input, &o, cfg)
+	testErrors(t, e, ValidationError{Type: ComparisonFailed, Key: "password,password_confirm"})
+}
+
+func TestUnmarshalXFieldEqualsSkipsAbsent(t *testing.T) {
+	cfg := &Options{FieldEquals: [][2]string{{"password", "password_confirm"}}}
+
+	var o map[string]interface{}
+	noErr(t, UnmarshalX([]byte(`{"password": "hunter2"}`), &o, cfg))
+}
+
+func TestUnmarshalXFieldEqualsCanonical(t *testing.T) {
+	cfg := &Options{FieldEquals: [][2]string{{"a", "b"}}}
+
+	var o map[string]interface{}
+	input := []byte(`{"a": {"x": 1, "y": [1.0]}, "b": {"y":[1],"x":1}}`)
+	noErr(t, UnmarshalX(input, &o, cfg))
+}
+
+func TestUnmarshalXDoublePointer(t *testing.T) {
+	cfg := &Options{Required: []string{"foo"}}
+
+	var p *TestStruct
+	noErr(t, UnmarshalX(tsEncoded, &p, cfg))
+	if p == nil {
+		t.Fatalf("got: nil, want: %#v", ts)
+	}
+	testTS(t, *p, ts)
+
+	o := &TestStruct{}
+	e := UnmarshalX([]byte(`{"bar": 4444}`), &o, cfg)
+	testErrors(t, e, ValidationError{Type: MissingKey, Key: "foo", Path: "/foo", PathSegments: []string{"foo"}})
+}
+
+func TestMarshalCanonical(t *testing.T) {
+	v := struct {
+		Zed   int                    `json:"zed"`
+		Alpha map[string]interface{} `json:"alpha"`
+		Mid   []TestStruct           `json:"mid"`
+	}{
+		Zed:   1,
+		Alpha: map[string]interface{}{"b": 2, "a": 1.5},
+		Mid:   []TestStruct{ts},
+	}
+
+	got, err := MarshalCanonical(v)
+	noErr(t, err)
+
+	want := `{"alpha":{"a":1.5,"b":2},"mid":[{"bar":4444,"foo":"foo"}],"zed":1}`
+	if string(got) != want {
+		t.Errorf("got: %s, want: %s", got, want)
+	}
+}
+
+func TestMarshalCanonicalKeepsNumbers(t *testing.T) {
+	got, err := MarshalCanonical(json.RawMessage(`{"b": 12345678901234567890, "a": 1e3}`))
+	noErr(t, err)
+
+	if want := `{"a":1e3,"b":12345678901234567890}`; string(got) != want {
+		t.Errorf("got: %s, want: %s", got, want)
+	}
+}
+
+func TestErrorCollectionWalkErrors(t *testing.T) {
+	errs := ErrorCollection{errors: []ValidationError{
+		{Type: MissingKey, Key: "foo", Path: "/foo", PathSegments: []string{"foo"}},
+		{Type: ForbiddenKey, Key: "bar", Path: "/bar", PathSegments: []string{"bar"}},
+		{Type: ForbiddenKey, Key: "baz", Path: "/baz", PathSegments: []string{"baz"}},
+	}}
+
+	count := 0
+	errs.WalkErrors(func(ValidationError) bool {
+		count++
+		return true
+	})
+	if count != 3 {
+		t.Errorf("got: %d, want: 3", count)
+	}
+
+	var seen []string
+	errs.WalkErrors(func(ve ValidationError) bool {
+		seen = append(seen, ve.Key)
+		return ve.Type != ForbiddenKey
+	})
+	if want := []string{"foo", "bar"}; !reflect.DeepEqual(seen, want) {
+		t.Errorf("got: %v, want: %v", seen, want)
+	}
+}
+
+func TestUnmarshalXRequiredPositive(t *testing.T) {
+	cfg := &Options{RequiredPositive: []string{"bar"}}
+	outOfRange := ValidationError{
+		Type:         OutOfRange,
+		Key:          "bar",
+		Path:         "/bar",
+		PathSegments: []string{"bar"},
+		Detail:       "must be a number greater than 0",
+	}
+
+	cases := []struct {
+		input string
+		want  []ValidationError
+	}{
+		{`{"foo": "foo"}`, []ValidationError{{Type: MissingKey, Key: "bar", Path: "/bar", PathSegments: []string{"bar"}}}},
+		{`{"bar": 0}`, []ValidationError{outOfRange}},
+		{`{"bar": -2}`, []ValidationError{outOfRange}},
+		{`{"bar": "7"}`, []ValidationError{outOfRange}},
+		{`{"bar": 7}`, nil},
+	}
+
+	for _, c := range cases {
+		o := TestStruct{}
+		e := UnmarshalX([]byte(c.input), &o, cfg)
+		if c.want == nil {
+			noErr(t, e)
+			continue
+		}
+		testErrors(t, e, c.want...)
+	}
+}
+
+func TestUnmarshalXCustomDecode(t *testing.T) {
+	var called []byte
+	cfg := &Options{
+		Required: []string{"foo"},
+		Decode: func(data []byte, v interface{}) error {
+			called = data
+			return json.Unmarshal(data, v)
+		},
+	}
+
+	o := TestStruct{}
+	noErr(t, UnmarshalX(tsEncoded, &o, cfg))
+	testTS(t, o, ts)
+	if string(called) != string(tsEncoded) {
+		t.Errorf("got: %q, want: %q", called, tsEncoded)
+	}
+
+	called = nil
+	e := UnmarshalX([]byte(`{}`), &o, cfg)
+	testErrors(t, e, ValidationError{Type: MissingKey, Key: "foo", Path: "/foo", PathSegments: []string{"foo"}})
+	if called != nil {
+		t.Errorf("got: %q, want: decode not called", called)
+	}
+}
+
+func TestUnmarshalXAtLeastNOf(t *testing.T) {
+	cfg := &Options{AtLeastNOf: []KeyGroup{{Keys: []string{"a", "b", "c"}, N: 2}}}
+
+	var o map[string]interface{}
+	e := UnmarshalX([]byte(`{"a": 1}`), &o, cfg)
+	testErrors(t, e, ValidationError{Type: AtLeastNOf, Key: "a,b,c", Detail: "1 present, 2 required"})
+
+	noErr(t, UnmarshalX([]byte(`{"a": 1, "c": 3}`), &o, cfg))
+	noErr(t, UnmarshalX([]byte(`{"a": 1, "b": 2, "c": 3}`), &o, cfg))
+}
+
+func TestUnmarshalXMutuallyExclusive(t *testing.T) {
+	cfg := &Options{
+		MutuallyExclusive: [][]string{{"inline_cert", "cert_file"}},
+		ExactlyOneOf:      [][]string{{"token", "password"}},
+		NullNotPresent:    []string{"cert_file"},
+	}
+
+	var o map[string]interface{}
+	noErr(t, UnmarshalX([]byte(`{"token": "t"}`), &o, cfg))
+	noErr(t, UnmarshalX([]byte(`{"inline_cert": "c", "cert_file": null, "password": "p"}`), &o, cfg))
+
+	e := UnmarshalX([]byte(`{"inline_cert": "c", "cert_file": "f"}`), &o, cfg)
+	testErrors(t, e,
+		ValidationError{Type: ConflictingKeys, Key: "inline_cert,cert_file", Detail: "found inline_cert, cert_file"},
+		ValidationError{Type: MissingGroup, Key: "token,password"})
+	if got, want := e.Error(), "['only one of keys <inline_cert,cert_file> may be set: found inline_cert, cert_file', "+
+		"'none of keys <token,password> were set']"; got != want {
+		t.Errorf("got: %q, want: %q", got, want)
+	}
+
+	testErrors(t, UnmarshalX([]byte(`{"token": "t", "password": "p"}`), &o, cfg),
+		ValidationError{Type: ConflictingKeys, Key: "token,password", Detail: "found token, password"})
+}
+
+func TestUnmarshalXAtLeastOne(t *testing.T) {
+	cfg := &Options{AtLeastOne: [][]string{{"token", "username", "cert"}}, GlobalNullNotPresent: true}
+
+	var o map[string]interface{}
+	noErr(t, UnmarshalX([]byte(`{"username": "u"}`), &o, cfg))
+	noErr(t, UnmarshalX([]byte(`{"token": "t", "cert": "c"}`), &o, cfg))
+
+	e := UnmarshalX([]byte(`{"token": null, "other": 1}`), &o, cfg)
+	testErrors(t, e, ValidationError{Type: MissingGroup, Key: "token,username,cert"})
+	if got, want := e.Error(), "['none of keys <token,username,cert> were set']"; got != want {
+		t.Errorf("got: %q, want: %q", got, want)
+	}
+
+	cfg.ApplyRecursively = true
+	testErrors(t, UnmarshalX([]byte(`{"cert": "c", "nested": {}}`), &o, cfg), ValidationError{
+		Type:         MissingGroup,
+		Key:          "nested.token,username,cert",
+		Path:         "/nested",
+		PathSegments: []string{"nested"},
+	})
+}
+
+func TestUnmarshalXPathSegments(t *testing.T) {
+	input := []byte(`{"a/b": {"list": [{"password": "x"}]}}`)
+	cfg := &Options{ApplyRecursively: true, Forbidden: []string{"password"}}
+
+	var o map[string]interface{}
+	e := UnmarshalX(input, &o, cfg)
+	testErrors(t, e, ValidationError{
+		Type:         ForbiddenKey,
+		Key:          "a/b.list[0].password",
+		Path:         "/a~1b/list/0/password",
+		PathSegments: []string{"a/b", "list", "0", "password"},
+	})
+}
+
+func TestUnmarshalXEmptyInput(t *testing.T) {
+	o := TestStruct{}
+
+	e := UnmarshalX([]byte{}, &o, &Options{})
+	testErrors(t, e, ValidationError{Type: EmptyInput})
+
+	e = UnmarshalX([]byte(" \n"), &o, &Options{Required: []string{"foo", "bar"}})
+	testErrors(t, e,
+		ValidationError{Type: MissingKey, Key: "foo", Path: "/foo", PathSegments: []string{"foo"}},
+		ValidationError{Type: MissingKey, Key: "bar", Path: "/bar", PathSegments: []string{"bar"}},
+	)
+}
+
+func TestUnmarshalXAllowEmptyInput(t *testing.T) {
+	o := TestStruct{Foo: "foo"}
+	noErr(t, UnmarshalX(nil, &o, &Options{AllowEmptyInput: true}))
+	testTS(t, o, TestStruct{Foo: "foo"})
+
+	e := UnmarshalX(nil, &o, &Options{AllowEmptyInput: true, Required: []string{"foo"}})
+	testErrors(t, e, ValidationError{Type: MissingKey, Key: "foo", Path: "/foo", PathSegments: []string{"foo"}})
+}
+
+func TestUnmarshalXRejectUndefinedString(t *testing.T) {
+	input := []byte(`{
+  "foo": "undefined",
+  "ok": "defined",
+  "outer": {"list": ["x", "undefined"]}
+}`)
+
+	var o map[string]interface{}
+	e := UnmarshalX(input, &o, &Options{RejectUndefinedString: true})
+	testErrors(t, e,
+		ValidationError{
+			Type:         InvalidString,
+			Key:          "foo",
+			Path:         "/foo",
+			PathSegments: []string{"foo"},
+			Detail:       `value is the string "undefined"`,
+		},
+		ValidationError{
+			Type:         InvalidString,
+			Key:          "outer.list[1]",
+			Path:         "/outer/list/1",
+			PathSegments: []string{"outer", "list", "1"},
+			Detail:       `value is the string "undefined"`,
+		},
+	)
+
+	noErr(t, UnmarshalX(input, &o, &Options{}))
+}
+
+func TestUnmarshalWithResultShortCircuited(t *testing.T) {
+	input := []byte(`{"bar": 4444}`)
+	o := TestStruct{}
+	cfg := Options{Required: []string{"foo", "baz"}}
+
+	res, err := UnmarshalWithResult(input, &o, &cfg)
+	if err == nil {
+		t.Fatalf("got: nil, want: error")
+	}
+	if len(res.Errors) != 2 || res.ShortCircuited {
+		t.Errorf("got: %#v, want: 2 errors and not short circuited", res)
+	}
+
+	cfg.FailFast = true
+	res, err = UnmarshalWithResult(input, &o, &cfg)
+	testErrors(t, err, res.Errors...)
+	want := ValidationResult{
+		Errors:         []ValidationError{{Type: MissingKey, Key: "foo", Path: "/foo", PathSegments: []string{"foo"}}},
+		ShortCircuited: true,
+	}
+	if !reflect.DeepEqual(res, want) {
+		t.Errorf("got: %#v, want: %#v", res, want)
+	}
+}
+
+func TestUnmarshalXAliases(t *testing.T) {
+	cfg := &Options{
+		Aliases:  map[string][]string{"foo": {"f", "name"}},
+		Required: []string{"foo"},
+	}
+
+	o := TestStruct{}
+	noErr(t, UnmarshalX([]byte(`{"name": "alias", "bar": 4444}`), &o, cfg))
+	testTS(t, o, TestStruct{"alias", ts.Bar})
+
+	// the canonical key wins over its aliases, the first alias over later ones
+	o = TestStruct{}
+	noErr(t, UnmarshalX([]byte(`{"f": "alias", "foo": "canonical"}`), &o, cfg))
+	testTS(t, o, TestStruct{Foo: "canonical"})
+
+	o = TestStruct{}
+	noErr(t, UnmarshalX([]byte(`{"name": "second", "f": "first"}`), &o, cfg))
+	testTS(t, o, TestStruct{Foo: "first"})
+
+	var m map[string]interface{}
+	noErr(t, UnmarshalX([]byte(`{"f": "alias", "foo": "canonical"}`), &m, cfg))
+	if want := map[string]interface{}{"foo": "canonical"}; !reflect.DeepEqual(m, want) {
+		t.Errorf("got: %#v, want: %#v", m, want)
+	}
+}
+
+func TestUnmarshalXForbidAliasCollision(t *testing.T) {
+	cfg := &Options{
+		Aliases:              map[string][]string{"foo": {"f"}},
+		ForbidAliasCollision: true,
+	}
+
+	o := TestStruct{}
+	e := UnmarshalX([]byte(`{"f": "alias", "foo": "canonical"}`), &o, cfg)
+	testErrors(t, e, ValidationError{
+		Type:         AliasCollision,
+		Key:          "f",
+		Path:         "/f",
+		PathSegments: []string{"f"},
+		Detail:       "<foo> is already set",
+	})
+
+	noErr(t, UnmarshalX([]byte(`{"f": "alias"}`), &o, cfg))
+	testTS(t, o, TestStruct{Foo: "alias"})
+}
+
+func TestUnmarshalXKeyPattern(t *testing.T) {
+	cfg := &Options{KeyPattern: `^[a-z][a-z0-9_]*$`}
+
+	var o map[string]interface{}
+	noErr(t, UnmarshalX([]byte(`{"snake_case": 1, "x2": 2}`), &o, cfg))
+
+	e := UnmarshalX([]byte(`{"camelCase": 1, "ok": 2, "2bad": 3}`), &o, cfg)
+	testErrors(t, e,
+		ValidationError{
+			Type:         InvalidKey,
+			Key:          "2bad",
+			Path:         "/2bad",
+			PathSegments: []string{"2bad"},
+			Detail:       "does not match ^[a-z][a-z0-9_]*$",
+		},
+		ValidationError{
+			Type:         InvalidKey,
+			Key:          "camelCase",
+			Path:         "/camelCase",
+			PathSegments: []string{"camelCase"},
+			Detail:       "does not match ^[a-z][a-z0-9_]*$",
+		},
+	)
+}
+
+func TestUnmarshalXInvalidKeyPattern(t *testing.T) {
+	var o map[string]interface{}
+	e := UnmarshalX([]byte(`{}`), &o, &Options{KeyPattern: `[`})
+	if _, ok := e.(ConfigError); !ok {
+		t.Errorf("got: %#v, want: ConfigError", e)
+	}
+}
+
+func TestUnmarshalXWarnOnly(t *testing.T) {
+	input := []byte(`{"bar": 4444}`)
+	cfg := &Options{WarnOnly: true, Required: []string{"foo"}, Forbidden: []string{"bar"}}
+
+	o := TestStruct{}
+	noErr(t, UnmarshalX(input, &o, cfg))
+	testTS(t, o, TestStruct{Bar: ts.Bar})
+
+	res, err := UnmarshalWithResult(input, &o, cfg)
+	noErr(t, err)
+	want := ValidationResult{Warnings: []ValidationError{
+		{Type: MissingKey, Key: "foo", Path: "/foo", PathSegments: []string{"foo"}},
+		{Type: ForbiddenKey, Key: "bar", Path: "/bar", PathSegments: []string{"bar"}},
+	}}
+	if !reflect.DeepEqual(res, want) {
+		t.Errorf("got: %#v, want: %#v", res, want)
+	}
+}
+
+func isConfigError(e error) bool {
+	_, ok := e.(ConfigError)
+	return ok
+}
+
+func TestUnmarshalXRequiredAndForbidden(t *testing.T) {
+	o := TestStruct{}
+	cfg := &Options{Required: []string{"foo", "bar"}, Forbidden: []string{"bar"}}
+
+	e := UnmarshalX(tsEncoded, &o, cfg)
+	want := ConfigError{"key <bar> is both required and forbidden"}
+	if !reflect.DeepEqual(e, want) {
+		t.Errorf("got: %#v, want: %#v", e, want)
+	}
+
+	cfg = &Options{RequiredPositive: []string{"bar"}, Forbidden: []string{"bar"}}
+	if _, ok := UnmarshalX(tsEncoded, &o, cfg).(ConfigError); !ok {
+		t.Errorf("got: %#v, want: ConfigError", e)
+	}
+}
+
+func TestUnmarshalXNumericKeys(t *testing.T) {
+	input := []byte(`{"0": "a", "1": "b", "3": "d"}`)
+
+	var o map[string]string
+	e := UnmarshalX(input, &o, &Options{Required: []string{"0", "2"}})
+	testErrors(t, e, ValidationError{Type: MissingKey, Key: "2", Path: "/2", PathSegments: []string{"2"}})
+}
+
+func TestUnmarshalXNumericKeysNested(t *testing.T) {
+	input := []byte(`{"m": {"7": {"x": 1}}, "l": [{"x": 2}]}`)
+	cfg := &Options{ApplyRecursively: true, Forbidden: []string{"x"}}
+
+	var o map[string]interface{}
+	testErrors(t, UnmarshalX(input, &o, cfg),
+		ValidationError{Type: ForbiddenKey, Key: "l[0].x", Path: "/l/0/x", PathSegments: []string{"l", "0", "x"}},
+		ValidationError{Type: ForbiddenKey, Key: "m.7.x", Path: "/m/7/x", PathSegments: []string{"m", "7", "x"}},
+	)
+}
+
+func TestUnmarshalXRequireContiguousIndices(t *testing.T) {
+	cfg := &Options{RequireContiguousIndices: true}
+
+	var o map[string]string
+	noErr(t, UnmarshalX([]byte(`{"1": "b", "0": "a", "2": "c"}`), &o, cfg))
+	noErr(t, UnmarshalX([]byte(`{"0": "a", "name": "c"}`), &o, cfg))
+
+	e := UnmarshalX([]byte(`{"0": "a", "3": "d"}`), &o, cfg)
+	testErrors(t, e,
+		ValidationError{Type: MissingKey, Key: "1", Path: "/1", PathSegments: []string{"1"}},
+		ValidationError{Type: MissingKey, Key: "2", Path: "/2", PathSegments: []string{"2"}},
+	)
+}
+
+func TestUnmarshalXRequireContiguousIndicesHugeIndex(t *testing.T) {
+	cfg := &Options{RequireContiguousIndices: true}
+
+	// the work done doesn't grow with the index the input names
+	var o map[string]int
+	start := time.Now()
+	e := UnmarshalX([]byte(`{"0": 0, "2": 2, "999999999999": 1}`), &o, cfg)
+	testErrors(t, e,
+		ValidationError{Type: MissingKey, Key: "1", Path: "/1", PathSegments: []string{"1"}},
+		ValidationError{Type: MissingKey, Key: "3", Path: "/3", PathSegments: []string{"3"},
+			Detail: "missing, as are the indices through 999999999998"})
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("took %v, want: well under a second", d)
+	}
+
+	cfg.FailFast = true
+	testErrors(t, UnmarshalX([]byte(`{"99999999": 1}`), &o, cfg),
+		ValidationError{Type: MissingKey, Key: "0", Path: "/0", PathSegments: []string{"0"},
+			Detail: "missing, as are the indices through 99999998"})
+
+	// the gaps generated are charged to the validation budget
+	defer SetValidationBudget(0)
+	SetValidationBudget(5)
+	cfg.FailFast = false
+	testErrors(t, UnmarshalX([]byte(`{"16": 1}`), &o, cfg),
+		ValidationError{Type: MissingKey, Key: "0", Path: "/0", PathSegments: []string{"0"}},
+		ValidationError{Type: MissingKey, Key: "1", Path: "/1", PathSegments: []string{"1"}},
+		ValidationError{Type: MissingKey, Key: "2", Path: "/2", PathSegments: []string{"2"}},
+		ValidationError{Type: MissingKey, Key: "3", Path: "/3", PathSegments: []string{"3"}},
+		NewValidationError(BudgetExceeded, "", "exceeded 5 units of work"))
+}
+
+func TestUnmarshalXMetaKeyPrefix(t *testing.T) {
+	cfg := &Options{
+		MetaKeyPrefix:            "@",
+		KeyPattern:               `^[a-z]+$`,
+		RequireContiguousIndices: true,
+	}
+
+	var o map[string]interface{}
+	noErr(t, UnmarshalX([]byte(`{"@type": "x", "name": "y"}`), &o, cfg))
+	noErr(t, UnmarshalX([]byte(`{"@type": "x", "0": "y", "1": "z"}`), &o, &Options{
+		MetaKeyPrefix:            "@",
+		RequireContiguousIndices: true,
+	}))
+
+	e := UnmarshalX([]byte(`{"@type": "x", "#type": "y"}`), &o, cfg)
+	testErrors(t, e, ValidationError{
+		Type:         InvalidKey,
+		Key:          "#type",
+		Path:         "/#type",
+		PathSegments: []string{"#type"},
+		Detail:       "does not match ^[a-z]+$",
+	})
+}
+
+func TestUnmarshalXMaxDistinctErrorKeys(t *testing.T) {
+	input := []byte(`{"a": {"x": 1}, "b": {"x": 2}}`)
+	cfg := &Options{
+		ApplyRecursively:     true,
+		MaxDistinctErrorKeys: 2,
+		Required:             []string{"x", "y", "z", "w"},
+	}
+
+	var o map[string]interface{}
+	e := UnmarshalX(input, &o, cfg)
+	testErrors(t, e,
+		ValidationError{Type: MissingKey, Key: "x", Path: "/x", PathSegments: []string{"x"}},
+		ValidationError{Type: MissingKey, Key: "y", Path: "/y", PathSegments: []string{"y"}},
+		ValidationError{Type: MissingKey, Key: "a.y", Path: "/a/y", PathSegments: []string{"a", "y"}},
+		ValidationError{Type: MissingKey, Key: "b.y", Path: "/b/y", PathSegments: []string{"b", "y"}},
+		ValidationError{Type: SuppressedErrors, Detail: "errors for 2 more keys were not reported"},
+	)
+}
+
+func TestUnmarshalXAnonymousStruct(t *testing.T) {
+	cfg := &Options{Required: []string{"foo"}}
+
+	o := &struct {
+		Foo string `json:"foo"`
+	}{}
+	noErr(t, UnmarshalX(tsEncoded, o, cfg))
+	if o.Foo != "foo" {
+		t.Errorf("got: %v, want: foo", o.Foo)
+	}
+
+	e := UnmarshalX([]byte(`{"bar": 4444}`), o, cfg)
+	testErrors(t, e, ValidationError{Type: MissingKey, Key: "foo", Path: "/foo", PathSegments: []string{"foo"}})
+}
+
+type FloatStruct struct {
+	Ratio  float64 `json:"ratio"`
+	Nested struct {
+		Scale *float32
+	} `json:"nested"`
+	Ignored float64 `json:"-"`
+}
+
+func TestUnmarshalXRejectNaNFields(t *testing.T) {
+	cfg := &Options{
+		RejectNaNFields: true,
+		Decode: func(data []byte, v interface{}) error {
+			// emulate a decoder which coerces bad input into NaN
+			inf := float32(math.Inf(1))
+			o := v.(*FloatStruct)
+			o.Ratio = math.NaN()
+			o.Nested.Scale = &inf
+			o.Ignored = math.NaN()
+			return nil
+		},
+	}
+
+	o := FloatStruct{}
+	e := UnmarshalX([]byte(`{"ratio": "bogus"}`), &o, cfg)
+	testErrors(t, e,
+		ValidationError{
+			Type:         NonFiniteNumber,
+			Key:          "ratio",
+			Path:         "/ratio",
+			PathSegments: []string{"ratio"},
+			Detail:       "NaN",
+		},
+		ValidationError{
+			Type:         NonFiniteNumber,
+			Key:          "nested.Scale",
+			Path:         "/nested/Scale",
+			PathSegments: []string{"nested", "Scale"},
+			Detail:       "+Inf",
+		},
+	)
+
+	o = FloatStruct{}
+	noErr(t, UnmarshalX([]byte(`{"ratio": 1.5}`), &o, &Options{RejectNaNFields: true}))
+}
+
+func TestUnmarshalXSyntaxErrorPosition(t *testing.T) {
+	input := []byte("{\n  \"foo\": \"foo\",\n  \"bar\": ]\n}")
+
+	o := TestStruct{}
+	e := UnmarshalX(input, &o, &Options{})
+	testErrors(t, e, ValidationError{
+		Type:   DecodeError,
+		Detail: "line 3, column 10: invalid character ']' looking for beginning of value",
+	})
+}
+
+func TestUnmarshalXTypeErrorUnchanged(t *testing.T) {
+	o := TestStruct{}
+	e := UnmarshalX([]byte(`{"bar": "x"}`), &o, &Options{})
+	if _, ok := e.(*json.UnmarshalTypeError); !ok {
+		t.Errorf("got: %#v, want: *json.UnmarshalTypeError", e)
+	}
+}
+
+func TestValidationResultMerge(t *testing.T) {
+	missing := ValidationError{Type: MissingKey, Key: "foo", Path: "/foo", PathSegments: []string{"foo"}}
+	forbidden := ValidationError{Type: ForbiddenKey, Key: "bar", Path: "/bar", PathSegments: []string{"bar"}}
+
+	header := ValidationResult{Errors: []ValidationError{missing}}
+	body := ValidationResult{
+		Errors:         []ValidationError{forbidden},
+		Warnings:       []ValidationError{missing},
+		ShortCircuited: true,
+	}
+
+	got := header.Merge(body)
+	want := ValidationResult{
+		Errors:         []ValidationError{missing, forbidden},
+		Warnings:       []ValidationError{missing},
+		ShortCircuited: true,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got: %#v, want: %#v", got, want)
+	}
+	if len(header.Errors) != 1 {
+		t.Errorf("got: %#v, want: receiver unchanged", header)
+	}
+}
+
+func TestUnmarshalXKeysEnum(t *testing.T) {
+	cfg := &Options{KeysEnum: []string{"red", "green", "blue"}, MetaKeyPrefix: "@"}
+
+	var o map[string]int
+	noErr(t, UnmarshalX([]byte(`{"red": 1, "blue": 2, "@version": 3}`), &o, cfg))
+
+	e := UnmarshalX([]byte(`{"red": 1, "purple": 2}`), &o, cfg)
+	testErrors(t, e, ValidationError{
+		Type:         InvalidKey,
+		Key:          "purple",
+		Path:         "/purple",
+		PathSegments: []string{"purple"},
+		Detail:       "not one of the allowed keys",
+	})
+}
+
+func TestUnmarshalXTraversalOrder(t *testing.T) {
+	input := []byte(`{
+  "z": {"password": "x"},
+  "a": [{"password": "y"}, {"password": "z"}],
+  "password": "w"
+}`)
+	cfg := &Options{ApplyRecursively: true, Forbidden: []string{"password"}}
+
+	var o map[string]interface{}
+	e := UnmarshalX(input, &o, cfg)
+	testErrors(t, e,
+		ValidationError{Type: ForbiddenKey, Key: "password", Path: "/password", PathSegments: []string{"password"}},
+		ValidationError{Type: ForbiddenKey, Key: "a[0].password", Path: "/a/0/password", PathSegments: []string{"a", "0", "password"}},
+		ValidationError{Type: ForbiddenKey, Key: "a[1].password", Path: "/a/1/password", PathSegments: []string{"a", "1", "password"}},
+		ValidationError{Type: ForbiddenKey, Key: "z.password", Path: "/z/password", PathSegments: []string{"z", "password"}},
+	)
+
+	cfg.FailFast = true
+	e = UnmarshalX(input, &o, cfg)
+	testErrors(t, e,
+		ValidationError{Type: ForbiddenKey, Key: "password", Path: "/password", PathSegments: []string{"password"}},
+	)
+
+	// with no error at the top level FailFast stops at the first child error
+	input = []byte(`{"z": {"password": "x"}, "a": [{"password": "y"}]}`)
+	e = UnmarshalX(input, &o, cfg)
+	testErrors(t, e,
+		ValidationError{Type: ForbiddenKey, Key: "a[0].password", Path: "/a/0/password", PathSegments: []string{"a", "0", "password"}},
+	)
+}
+
+func TestUnmarshalXRejectScientificNotation(t *testing.T) {
+	cfg := &Options{RejectScientificNotation: []string{"count"}}
+
+	var o map[string]interface{}
+	noErr(t, UnmarshalX([]byte(`{"count": 1000, "other": 1e3}`), &o, cfg))
+	noErr(t, UnmarshalX([]byte(`{"count": "1e3"}`), &o, cfg))
+
+	testErrors(t, UnmarshalX([]byte(`{"count": 1e3}`), &o, cfg),
+		NewValidationError(InvalidNumber, "/count", "written in scientific notation"))
+
+	cfg = &Options{GlobalRejectScientificNotation: true}
+	noErr(t, UnmarshalX([]byte(`{"count": 1000, "ratio": -0.5}`), &o, cfg))
+	testErrors(t, UnmarshalX([]byte(`{"count": 1E3, "ratio": 5e-1, "size": 10}`), &o, cfg),
+		NewValidationError(InvalidNumber, "/count", "written in scientific notation"),
+		NewValidationError(InvalidNumber, "/ratio", "written in scientific notation"))
+}
+
+func TestUnmarshalXWholeNumber(t *testing.T) {
+	cfg := &Options{WholeNumber: []string{"count"}}
+
+	var o map[string]interface{}
+	noErr(t, UnmarshalX([]byte(`{"count": 2}`), &o, cfg))
+	noErr(t, UnmarshalX([]byte(`{"count": 2.0}`), &o, cfg))
+	noErr(t, UnmarshalX([]byte(`{"other": 2.5}`), &o, cfg))
+
+	e := UnmarshalX([]byte(`{"count": 2.5}`), &o, cfg)
+	testErrors(t, e, ValidationError{
+		Type:         InvalidNumber,
+		Key:          "count",
+		Path:         "/count",
+		PathSegments: []string{"count"},
+		Detail:       "not a whole number",
+	})
+
+	e = UnmarshalX([]byte(`{"count": "2"}`), &o, cfg)
+	testErrors(t, e, ValidationError{
+		Type:         InvalidNumber,
+		Key:          "count",
+		Path:         "/count",
+		PathSegments: []string{"count"},
+		Detail:       "not a number",
+	})
+}
+
+func TestUnmarshalXCanonicalize(t *testing.T) {
+	cfg := &Options{Canonicalize: true, Required: []string{"foo"}}
+
+	var a, b map[string]interface{}
+	resA, err := UnmarshalWithResult([]byte(`{"foo": "x", "bar": {"z": 1, "a": [true, null]}}`), &a, cfg)
+	noErr(t, err)
+	resB, err := UnmarshalWithResult([]byte(`{
+  "bar": {"a": [true, null], "z": 1},
+  "foo": "x"
+}`), &b, cfg)
+	noErr(t, err)
+
+	want := `{"bar":{"a":[true,null],"z":1},"foo":"x"}`
+	if string(resA.Canonical) != want || string(resB.Canonical) != want {
+		t.Errorf("got: %s and %s, want: %s", resA.Canonical, resB.Canonical, want)
+	}
+	if !reflect.DeepEqual(a, b) {
+		t.Errorf("got: %#v, want: %#v", a, b)
+	}
+
+	res, err := UnmarshalWithResult(tsEncoded, &a, &Options{})
+	noErr(t, err)
+	if res.Canonical != nil {
+		t.Errorf("got: %s, want: nil", res.Canonical)
+	}
+}
+
+func TestUnmarshalXFieldOptions(t *testing.T) {
+	cfg := &Options{
+		Required: []string{"host"},
+		FieldOptions: map[string]*Options{
+			"tls": {Required: []string{"cert", "key"}},
+		},
+	}
+
+	var o map[string]interface{}
+	noErr(t, UnmarshalX([]byte(`{"host": "localhost"}`), &o, cfg))
+	noErr(t, UnmarshalX([]byte(`{"host": "localhost", "tls": null}`), &o, cfg))
+	noErr(t, UnmarshalX([]byte(`{"host": "localhost", "tls": {"cert": "c", "key": "k"}}`), &o, cfg))
+
+	e := UnmarshalX([]byte(`{"tls": {"cert": "c"}}`), &o, cfg)
+	testErrors(t, e,
+		ValidationError{Type: MissingKey, Key: "host", Path: "/host", PathSegments: []string{"host"}},
+		ValidationError{Type: MissingKey, Key: "tls.key", Path: "/tls/key", PathSegments: []string{"tls", "key"}},
+	)
+
+	// a nil entry has no rules of its own
+	cfg.FieldOptions["tls"] = nil
+	noErr(t, UnmarshalX([]byte(`{"host": "localhost", "tls": {}}`), &o, cfg))
+	testErrors(t, UnmarshalX([]byte(`{"tls": {}}`), &o, cfg), NewMissingKeyError("/host"))
+}
+
+func TestUnmarshalXFieldOptionsConfigError(t *testing.T) {
+	cfg := &Options{FieldOptions: map[string]*Options{"tls": {KeyPattern: `(`}}}
+
+	var o map[string]interface{}
+	if e := UnmarshalX([]byte(`{}`), &o, cfg); !isConfigError(e) {
+		t.Errorf("got: %#v, want: ConfigError", e)
+	}
+}
+
+func TestUnmarshalXForbiddenInArrayElements(t *testing.T) {
+	input := []byte(`{
+  "items": [{"id": 1}, {"id": 2, "secret": "x"}],
+  "matrix": [[{"id": 3}], [{"secret": "y"}]]
+}`)
+	cfg := &Options{ApplyRecursively: true, Forbidden: []string{"secret"}}
+
+	var o map[string]interface{}
+	e := UnmarshalX(input, &o, cfg)
+	testErrors(t, e,
+		ValidationError{Type: ForbiddenKey, Key: "items[1].secret", Path: "/items/1/secret", PathSegments: []string{"items", "1", "secret"}},
+		ValidationError{Type: ForbiddenKey, Key: "matrix[1][0].secret", Path: "/matrix/1/0/secret", PathSegments: []string{"matrix", "1", "0", "secret"}},
+	)
+}
+
+func TestValidationErrorConstructors(t *testing.T) {
+	cases := []struct {
+		got, want ValidationError
+	}{
+		{
+			NewMissingKeyError("/foo"),
+			ValidationError{Type: MissingKey, Key: "foo", Path: "/foo", PathSegments: []string{"foo"}},
+		},
+		{
+			NewForbiddenKeyError("/outer/a~1b"),
+			ValidationError{Type: ForbiddenKey, Key: "outer.a/b", Path: "/outer/a~1b", PathSegments: []string{"outer", "a/b"}},
+		},
+		{
+			NewValidationError(EmptyInput, "", ""),
+			ValidationError{Type: EmptyInput},
+		},
+		{
+			NewValidationError(OutOfRange, "/bar", "must be a number greater than 0"),
+			ValidationError{Type: OutOfRange, Key: "bar", Path: "/bar", PathSegments: []string{"bar"}, Detail: "must be a number greater than 0"},
+		},
+	}
+
+	for _, c := range cases {
+		if !reflect.DeepEqual(c.got, c.want) {
+			t.Errorf("got: %#v, want: %#v", c.got, c.want)
+		}
+	}
+}
+
+func TestValidationErrorConstructorsMatchUnmarshalX(t *testing.T) {
+	o := TestStruct{}
+	cfg := &Options{Required: []string{"foo"}, Forbidden: []string{"bar"}}
+	e := UnmarshalX([]byte(`{"bar": 4444}`), &o, cfg)
+	testErrors(t, e, NewMissingKeyError("/foo"), NewForbiddenKeyError("/bar"))
+}
+
+func TestUnmarshalXRequiredPaths(t *testing.T) {
+	cfg := &Options{RequiredPaths: [][]string{
+		{"items", "0", "id"},
+		{"server", "host"},
+	}}
+
+	var o map[string]interface{}
+	noErr(t, UnmarshalX([]byte(`{"items": [{"id": 1}, {}], "server": {"host": "h"}}`), &o, cfg))
+
+	e := UnmarshalX([]byte(`{"items": [{"name": "x"}, {"id": 2}], "server": {"port": 1}}`), &o, cfg)
+	testErrors(t, e,
+		NewMissingKeyError("/items/0/id"),
+		NewMissingKeyError("/server/host"),
+	)
+
+	e = UnmarshalX([]byte(`{"items": [], "server": "h"}`), &o, cfg)
+	testErrors(t, e,
+		NewMissingKeyError("/items/0/id"),
+		NewMissingKeyError("/server/host"),
+	)
+}
+
+func TestUnmarshalXRequiredPathsNull(t *testing.T) {
+	input := []byte(`{"server": {"host": null}}`)
+	cfg := &Options{RequiredPaths: [][]string{{"server", "host"}}}
+
+	var o map[string]interface{}
+	noErr(t, UnmarshalX(input, &o, cfg))
+
+	cfg.NullNotPresent = []string{"host"}
+	e := UnmarshalX(input, &o, cfg)
+	testErrors(t, e, NewMissingKeyError("/server/host"))
+}
+
+func TestUnmarshalXKeyOrder(t *testing.T) {
+	cfg := &Options{KeyOrder: []string{"alg", "typ", "kid"}}
+
+	var o map[string]interface{}
+	noErr(t, UnmarshalX([]byte(`{"alg": "x", "other": 1, "kid": "z"}`), &o, cfg))
+	noErr(t, UnmarshalX([]byte(`{"typ": "y"}`), &o, cfg))
+
+	e := UnmarshalX([]byte(`{"alg": "x", "kid": "z", "typ": "y", "other": 1}`), &o, cfg)
+	testErrors(t, e, NewValidationError(OutOfOrder, "/typ", "must appear before <kid>"))
+}
+
+func TestUnmarshalXRejectDuplicateKeys(t *testing.T) {
+	cfg := &Options{RejectDuplicateKeys: true}
+
+	var o map[string]interface{}
+	noErr(t, UnmarshalX([]byte(`{"a": {"b": 1}, "b": [{"b": 2}, {"b": 3}]}`), &o, cfg))
+
+	e := UnmarshalX([]byte(`{"a": 1, "b": {"c": 1, "c": 2, "c": 3}, "a": 2, "d": [{}, {"e": 1, "e": 2}]}`), &o, cfg)
+	testErrors(t, e,
+		NewValidationError(DuplicateKey, "/b/c", ""),
+		NewValidationError(DuplicateKey, "/a", ""),
+		NewValidationError(DuplicateKey, "/d/1/e", ""))
+	if got, want := e.(ErrorCollection).errors[2].Error(), "key <d[1].e> appears more than once"; got != want {
+		t.Errorf("got: %q, want: %q", got, want)
+	}
+
+	cfg.FailFast = true
+	testErrors(t, UnmarshalX([]byte(`{"a": 1, "a": 2, "b": 1, "b": 2}`), &o, cfg),
+		NewValidationError(DuplicateKey, "/a", ""))
+}
+
+func TestUnmarshalXForbidCaseInsensitiveDuplicateKeys(t *testing.T) {
+	cfg := &Options{ForbidCaseInsensitiveDuplicateKeys: true}
+
+	var o map[string]interface{}
+	noErr(t, UnmarshalX([]byte(`{"Host": 1, "port": 2, "nested": {"host": 3}}`), &o, cfg))
+
+	e := UnmarshalX([]byte(`{"Host":1,"host":2}`), &o, cfg)
+	testErrors(t, e, NewValidationError(DuplicateKey, "/host", "ignoring case, as <Host>"))
+	if got, want := e.Error(), "['key <host> appears more than once: ignoring case, as <Host>']"; got != want {
+		t.Errorf("got: %q, want: %q", got, want)
+	}
+
+	// exact repeats are only reported with RejectDuplicateKeys
+	e = UnmarshalX([]byte(`{"a": {"ID": 1, "id": 2, "id": 3, "Id": 4}}`), &o, cfg)
+	testErrors(t, e,
+		NewValidationError(DuplicateKey, "/a/id", "ignoring case, as <ID>"),
+		NewValidationError(DuplicateKey, "/a/Id", "ignoring case, as <ID>"))
+
+	cfg.RejectDuplicateKeys = true
+	e = UnmarshalX([]byte(`{"a": {"ID": 1, "id": 2, "id": 3}}`), &o, cfg)
+	testErrors(t, e,
+		NewValidationError(DuplicateKey, "/a/id", "ignoring case, as <ID>"),
+		NewValidationError(DuplicateKey, "/a/id", ""))
+}
+
+func TestUnmarshalXTopLevelArray(t *testing.T) {
+	cfg := &Options{Required: []string{"foo"}, Forbidden: []string{"secret"}}
+
+	var o []TestStruct
+	noErr(t, UnmarshalX([]byte(` [{"foo": "a"}, {"foo": "b", "bar": 1}]`), &o, cfg))
+	if len(o) != 2 || o[0].Foo != "a" || o[1].Foo != "b" {
+		t.Errorf("got: %+v, want: foo a and b", o)
+	}
+	noErr(t, UnmarshalX([]byte(`[]`), &o, cfg))
+
+	e := UnmarshalX([]byte(`[{"foo": "a"}, {"bar": 1, "secret": 2}, 3]`), &o, cfg)
+	testErrors(t, e,
+		NewMissingKeyError("/1/foo"),
+		NewForbiddenKeyError("/1/secret"),
+		NewValidationError(TypeMismatch, "/2", "want object, got number"))
+	if got, want := e.Error(), "['required key <[1].foo> not found', 'forbidden key <[1].secret> was set', "+
+		"'key <[2]> has the wrong type: want object, got number']"; got != want {
+		t.Errorf("got: %q, want: %q", got, want)
+	}
+
+	// rewrites apply to each element
+	noErr(t, UnmarshalX([]byte(`[{"foo": "a", "bar": null}, {"name": "b"}]`), &o,
+		&Options{StripNulls: true, Aliases: map[string][]string{"foo": {"name"}}}))
+	if len(o) != 2 || o[1].Foo != "b" {
+		t.Errorf("got: %+v, want: the alias resolved", o)
+	}
+
+	var s []strictStruct
+	testErrors(t, UnmarshalX([]byte(`[{"id": "1", "name": "n", "other": 1}]`), &s, &Options{Strict: true}),
+		NewValidationError(UnknownKey, "/0/other", ""))
+}
+
+func TestUnmarshalXScalarDocument(t *testing.T) {
+	var o map[string]interface{}
+	e := UnmarshalX([]byte(`"foo"`), &o, &Options{})
+	testErrors(t, e, NewValidationError(TypeMismatch, "", "want object or array, got string"))
+	if got, want := e.Error(), "['document has the wrong type: want object or array, got string']"; got != want {
+		t.Errorf("got: %q, want: %q", got, want)
+	}
+}
+
+func TestUnmarshalErrors(t *testing.T) {
+	o := TestStruct{}
+	if errs := UnmarshalErrors(tsEncoded, &o, &Options{Required: []string{"foo"}}); len(errs) != 0 {
+		t.Errorf("got: %#v, want: no errors", errs)
+	}
+	testTS(t, o, ts)
+
+	errs := UnmarshalErrors([]byte(`{"bar": 4444}`), &o, &Options{Required: []string{"foo"}, Forbidden: []string{"bar"}})
+	want := []ValidationError{NewMissingKeyError("/foo"), NewForbiddenKeyError("/bar")}
+	if !reflect.DeepEqual(errs, want) {
+		t.Errorf("got: %#v, want: %#v", errs, want)
+	}
+
+	input := []byte(`{"bar": "x"}`)
+	errs = UnmarshalErrors(input, &o, &Options{})
+	want = []ValidationError{NewValidationError(DecodeError, "", json.Unmarshal(input, &o).Error())}
+	if !reflect.DeepEqual(errs, want) {
+		t.Errorf("got: %#v, want: %#v", errs, want)
+	}
+}
+
+func TestUnmarshalXForbiddenOnlyWhenPresent(t *testing.T) {
+	o := TestStruct{}
+	noErr(t, UnmarshalX([]byte(`{"foo": "x"}`), &o, &Options{Forbidden: []string{"bar"}}))
+	testTS(t, o, TestStruct{Foo: "x"})
+
+	e := UnmarshalX([]byte(`{"foo": "x", "bar": 1}`), &o, &Options{Forbidden: []string{"bar"}})
+	testErrors(t, e, NewForbiddenKeyError("/bar"))
+}
+
+func TestUnmarshalXForbiddenNull(t *testing.T) {
+	input := []byte(`{"foo": "x", "bar": null}`)
+
+	for _, cfg := range []*Options{
+		{Forbidden: []string{"bar"}},
+		{Forbidden: []string{"bar"}, NullNotPresent: []string{"bar"}},
+		{Forbidden: []string{"bar"}, GlobalNullNotPresent: true},
+	} {
+		o := TestStruct{}
+		e := UnmarshalX(input, &o, cfg)
+		testErrors(t, e, NewForbiddenKeyError("/bar"))
+	}
+}
+
+func TestUnmarshalXForbiddenPresenceNested(t *testing.T) {
+	input := []byte(`{"a": {"password": null}, "b": {"c": {}}, "list": [{}, {"password": null}]}`)
+	cfg := &Options{ApplyRecursively: true, Forbidden: []string{"password"}, GlobalNullNotPresent: true}
+
+	// objects without the key aren't reported, and null still counts as set
+	var o map[string]interface{}
+	testErrors(t, UnmarshalX(input, &o, cfg),
+		NewForbiddenKeyError("/a/password"),
+		NewForbiddenKeyError("/list/1/password"))
+}
+
+func TestSetValidationBudget(t *testing.T) {
+	defer SetValidationBudget(0)
+
+	input := []byte(`{"a": [1, 2, 3], "b": {"c": [4, 5, 6]}}`)
+	cfg := &Options{ApplyRecursively: true, Forbidden: []string{"x"}}
+
+	var o map[string]interface{}
+	SetValidationBudget(100)
+	noErr(t, UnmarshalX(input, &o, cfg))
+
+	SetValidationBudget(5)
+	e := UnmarshalX(input, &o, cfg)
+	testErrors(t, e, NewValidationError(BudgetExceeded, "", "exceeded 5 units of work"))
+
+	SetValidationBudget(0)
+	noErr(t, UnmarshalX(input, &o, cfg))
+}
+
+func TestSetValidationBudgetDeeplyNested(t *testing.T) {
+	defer SetValidationBudget(0)
+
+	// the bytes walked are charged, so deep nesting is stopped by the budget
+	// however few items it holds
+	var o map[string]interface{}
+	SetValidationBudget(1000)
+	start := time.Now()
+	testErrors(t, UnmarshalX(deeplyNested, &o, &Options{MaxItemsDeep: 5}),
+		NewValidationError(BudgetExceeded, "", "exceeded 1000 units of work"))
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("took %v", d)
+	}
+
+	SetValidationBudget(0)
+	noErr(t, UnmarshalX(deeplyNested, &o, &Options{MaxItemsDeep: 5}))
+}
+
+func TestSetValidationBudgetRootArray(t *testing.T) {
+	defer SetValidationBudget(0)
+
+	var o []map[string]interface{}
+	SetValidationBudget(3)
+	e := UnmarshalX([]byte(`[{}, {}, {}, {}, {}, {}, {}]`), &o, &Options{})
+	testErrors(t, e, NewValidationError(BudgetExceeded, "", "exceeded 3 units of work"))
+}
+
+type strictBase struct {
+	ID string `json:"id"`
+}
+
+type strictStruct struct {
+	strictBase
+	Name    string `json:"name"`
+	Ignored string `json:"-"`
+	Plain   int
+}
+
+func TestStrict(t *testing.T) {
+	cfg := &Options{Strict: true, MetaKeyPrefix: "@"}
+
+	var o strictStruct
+	noErr(t, UnmarshalX([]byte(`{"id": "1", "NAME": "n", "plain": 2, "@meta": 3}`), &o, cfg))
+	if o.ID != "1" || o.Name != "n" || o.Plain != 2 {
+		t.Errorf("got: %+v", o)
+	}
+
+	e := UnmarshalX([]byte(`{"id": "1", "Ignored": "x", "strictBase": {}, "zed": 1}`), &o, cfg)
+	testErrors(t, e,
+		NewValidationError(UnknownKey, "/Ignored", ""),
+		NewValidationError(UnknownKey, "/strictBase", ""),
+		NewValidationError(UnknownKey, "/zed", ""))
+
+	// a pointer to a pointer is followed to the struct
+	po := &o
+	e = UnmarshalX([]byte(`{"zed": 1}`), &po, cfg)
+	testErrors(t, e, NewValidationError(UnknownKey, "/zed", ""))
+
+	cfg.FailFast = true
+	e = UnmarshalX([]byte(`{"a": 1, "b": 2}`), &o, cfg)
+	testErrors(t, e, NewValidationError(UnknownKey, "/a", ""))
+
+	// destinations that aren't structs accept any key
+	var m map[string]interface{}
+	noErr(t, UnmarshalX([]byte(`{"zed": 1}`), &m, cfg))
+}
+
+func TestStrictCollapseUnknownKeys(t *testing.T) {
+	cfg := &Options{Strict: true, CollapseUnknownKeys: true}
+
+	var o strictStruct
+	noErr(t, UnmarshalX([]byte(`{"id": "1", "name": "n"}`), &o, cfg))
+
+	e := UnmarshalX([]byte(`{"id": "1", "Ignored": "x", "zed": 1, "name": "n", "alpha": 2}`), &o, cfg)
+	testErrors(t, e, ValidationError{Type: UnknownKey, Key: "Ignored,alpha,zed"})
+	if want := "['unknown key <Ignored,alpha,zed> is not a field of the destination']"; e.Error() != want {
+		t.Errorf("got: %q, want: %q", e.Error(), want)
+	}
+}
+
+func TestDisallowUnknownFields(t *testing.T) {
+	cfg := &Options{DisallowUnknownFields: true, Required: []string{"id"}}
+
+	type nested struct {
+		ID    string       `json:"id"`
+		Inner strictStruct `json:"inner"`
+	}
+	var o nested
+	noErr(t, UnmarshalX([]byte(`{"id": "x", "inner": {"id": "1", "name": "n"}}`), &o, &Options{DisallowUnknownFields: true}))
+
+	e := UnmarshalX([]byte(`{"id": "1", "inner": {"zed": 1}}`), &o, cfg)
+	testErrors(t, e, ValidationError{
+		Type:         UnknownKey,
+		Key:          "inner.zed",
+		Path:         "/inner/zed",
+		PathSegments: []string{"inner", "zed"},
+	})
+	if got, want := e.Error(), "['unknown key <inner.zed> is not a field of the destination']"; got != want {
+		t.Errorf("got: %q, want: %q", got, want)
+	}
+
+	// keys are followed through slices and maps of structs
+	var list []map[string]strictStruct
+	e = UnmarshalX([]byte(`[{"a": {"id": "1"}}, {"b": {"NAME": "n", "zed": 1}}]`), &list, &Options{DisallowUnknownFields: true})
+	testErrors(t, e, NewValidationError(UnknownKey, "/1/b/zed", ""))
+
+	// a custom Decode is still checked
+	cfg.Decode = json.Unmarshal
+	testErrors(t, UnmarshalX([]byte(`{"id": "1", "inner": {"zed": 1}}`), &o, cfg),
+		NewValidationError(UnknownKey, "/inner/zed", ""))
+	cfg.Decode = nil
+
+	// validation errors are still reported before decoding
+	testErrors(t, UnmarshalX([]byte(`{"zed": 1}`), &o, cfg), NewMissingKeyError("/id"))
+
+	// other decode errors are returned unchanged
+	if _, ok := UnmarshalX([]byte(`{"id": "1", "inner": {"id": 1}}`), &o, cfg).(*json.UnmarshalTypeError); !ok {
+		t.Errorf("want: *json.UnmarshalTypeError")
+	}
+
+	// with WarnOnly the unknown key is a warning and the input is decoded
+	var s TestStruct
+	res, err := UnmarshalWithResult([]byte(`{"foo": "x", "zz": 1}`), &s, &Options{DisallowUnknownFields: true, WarnOnly: true})
+	noErr(t, err)
+	want := ValidationResult{Warnings: []ValidationError{NewValidationError(UnknownKey, "/zz", "")}}
+	if !reflect.DeepEqual(res, want) {
+		t.Errorf("got: %#v, want: %#v", res, want)
+	}
+	if s.Foo != "x" {
+		t.Errorf("got: %+v", s)
+	}
+}
+
+func TestReportUnknownKeys(t *testing.T) {
+	cfg := &Options{ReportUnknownKeys: true, Required: []string{"name"}, MetaKeyPrefix: "@"}
+
+	var o strictStruct
+	res, err := UnmarshalWithResult([]byte(`{"id": "1", "name": "n", "zed": 1, "@meta": 2, "Extra": 3}`), &o, cfg)
+	noErr(t, err)
+	if want := []string{"Extra", "zed"}; !reflect.DeepEqual(res.UnknownKeys, want) {
+		t.Errorf("got: %v, want: %v", res.UnknownKeys, want)
+	}
+	if o.ID != "1" || o.Name != "n" {
+		t.Errorf("got: %+v", o)
+	}
+
+	// unknown keys are listed alongside any errors
+	res, err = UnmarshalWithResult([]byte(`{"zed": 1}`), &o, cfg)
+	testErrors(t, err, NewMissingKeyError("/name"))
+	if want := []string{"zed"}; !reflect.DeepEqual(res.UnknownKeys, want) {
+		t.Errorf("got: %v, want: %v", res.UnknownKeys, want)
+	}
+
+	var list []strictStruct
+	res, err = UnmarshalWithResult([]byte(`[{"name": "a"}, {"name": "b", "zed": 1}]`), &list, cfg)
+	noErr(t, err)
+	if want := []string{"[1].zed"}; !reflect.DeepEqual(res.UnknownKeys, want) {
+		t.Errorf("got: %v, want: %v", res.UnknownKeys, want)
+	}
+
+	var m map[string]interface{}
+	res, err = UnmarshalWithResult([]byte(`{"name": "n", "zed": 1}`), &m, cfg)
+	noErr(t, err)
+	if res.UnknownKeys != nil {
+		t.Errorf("got: %v, want: no keys for a map", res.UnknownKeys)
+	}
+}
+
+func TestHomogeneousArrays(t *testing.T) {
+	cfg := &Options{HomogeneousArrays: []string{"tags", "ids"}}
+
+	var o map[string]interface{}
+	noErr(t, UnmarshalX([]byte(`{"tags": ["a", "b"], "ids": [1, 2.5, 3], "other": [1, "x"]}`), &o, cfg))
+	noErr(t, UnmarshalX([]byte(`{"tags": [], "ids": "not an array"}`), &o, cfg))
+
+	e := UnmarshalX([]byte(`{"tags": ["a", 1, true], "ids": [1, null]}`), &o, cfg)
+	testErrors(t, e,
+		NewValidationError(MixedTypes, "/tags", "element 1 is a number, element 0 is a string"),
+		NewValidationError(MixedTypes, "/ids", "element 1 is null, element 0 is a number"))
+}
+
+func TestPedantic(t *testing.T) {
+	cfg := &Options{Pedantic: true}
+
+	var o strictStruct
+	noErr(t, UnmarshalX([]byte(`{"id": "1", "name": "n", "Plain": 2}`), &o, cfg))
+
+	e := UnmarshalX([]byte(`{"id": "1", "Plain": 2, "zed": 3}`), &o, cfg)
+	testErrors(t, e,
+		NewMissingKeyError("/name"),
+		NewValidationError(UnknownKey, "/zed", ""))
+
+	// null handling is still driven by NullNotPresent
+	noErr(t, UnmarshalX([]byte(`{"id": null, "name": "n", "Plain": 2}`), &o, cfg))
+	cfg.NullNotPresent = []string{"id"}
+	testErrors(t, UnmarshalX([]byte(`{"id": null, "name": "n", "Plain": 2}`), &o, cfg),
+		NewMissingKeyError("/id"))
+
+	// forbidden fields stay forbidden and are only reported once
+	cfg = &Options{Pedantic: true, Required: []string{"extra"}, Forbidden: []string{"name", "zed"}}
+	e = UnmarshalX([]byte(`{"id": "1", "Plain": 2, "zed": 3}`), &o, cfg)
+	testErrors(t, e,
+		NewMissingKeyError("/extra"),
+		NewForbiddenKeyError("/zed"))
+	if len(cfg.Required) != 1 {
+		t.Errorf("Pedantic modified the caller's Required: %v", cfg.Required)
+	}
+}
+
+func TestDistinguishAbsentFromNull(t *testing.T) {
+	cfg := &Options{
+		Required:       []string{"foo", "bar"},
+		NullNotPresent: []string{"foo", "bar"},
+	}
+
+	input := []byte(`{"foo": null}`)
+	testErrors(t, UnmarshalX(input, &ts, cfg), NewMissingKeyError("/foo"), NewMissingKeyError("/bar"))
+
+	cfg.DistinguishAbsentFromNull = true
+	testErrors(t, UnmarshalX(input, &ts, cfg),
+		NewValidationError(NullNotAllowed, "/foo", ""),
+		NewMissingKeyError("/bar"))
+
+	cfg = &Options{
+		RequiredPaths:             [][]string{{"a", "b"}, {"a", "c"}},
+		GlobalNullNotPresent:      true,
+		DistinguishAbsentFromNull: true,
+	}
+	var o map[string]interface{}
+	testErrors(t, UnmarshalX([]byte(`{"a": {"b": null}}`), &o, cfg),
+		NewValidationError(NullNotAllowed, "/a/b", ""),
+		NewMissingKeyError("/a/c"))
+}
+
+func TestDottedKeys(t *testing.T) {
+	cfg := &Options{
+		Required:       []string{"server.host", "server.port", "a.b"},
+		Forbidden:      []string{"server.debug"},
+		NullNotPresent: []string{"server.port"},
+	}
+
+	var o map[string]interface{}
+	noErr(t, UnmarshalX([]byte(`{"server": {"host": "h", "port": 1}, "a.b": 1}`), &o, cfg))
+	noErr(t, UnmarshalX([]byte(`{"server": {"host": null, "port": 1}, "a": {"b": 2}}`), &o, cfg))
+
+	e := UnmarshalX([]byte(`{"server": {"port": null, "debug": false}, "a": 1}`), &o, cfg)
+	testErrors(t, e,
+		ValidationError{Type: MissingKey, Key: "server.host", Path: "/server/host", PathSegments: []string{"server", "host"}},
+		ValidationError{Type: MissingKey, Key: "server.port", Path: "/server/port", PathSegments: []string{"server", "port"}},
+		ValidationError{Type: MissingKey, Key: "a.b", Path: "/a/b", PathSegments: []string{"a", "b"}},
+		ValidationError{Type: ForbiddenKey, Key: "server.debug", Path: "/server/debug", PathSegments: []string{"server", "debug"}})
+
+	first, _ := e.(ErrorCollection).First(MissingKey)
+	if got, want := first.Error(), "required key <server.host> not found"; got != want {
+		t.Errorf("got: %q, want: %q", got, want)
+	}
+}
+
+func TestEnumWhen(t *testing.T) {
+	cfg := &Options{EnumWhen: []ConditionalEnum{
+		{Trigger: "type", TriggerValue: json.RawMessage(`"image"`), Key: "subtype", Allowed: []string{"png", "jpeg"}},
+		{Trigger: "type", TriggerValue: json.RawMessage(`"text"`), Key: "subtype", Allowed: []string{"plain", "html"}},
+	}}
+
+	var o map[string]interface{}
+	for _, input := range []string{
+		`{"type": "image", "subtype": "png"}`,
+		`{"type": "text", "subtype": "html"}`,
+		`{"type": "text"}`,
+		`{"type": "audio", "subtype": "mp3"}`,
+	} {
+		noErr(t, UnmarshalX([]byte(input), &o, cfg))
+	}
+
+	testErrors(t, UnmarshalX([]byte(`{"type": "image", "subtype": "html"}`), &o, cfg),
+		NewValidationError(InvalidEnum, "/subtype", `must be one of png, jpeg when <type> is "image"`))
+	testErrors(t, UnmarshalX([]byte(`{"type": "text", "subtype": 1}`), &o, cfg),
+		NewValidationError(InvalidEnum, "/subtype", `must be one of plain, html when <type> is "text"`))
+}
+
+func TestAllowedNumbers(t *testing.T) {
+	cfg := &Options{AllowedNumbers: map[string][]float64{"retries": {1, 3, 5}, "ratio": {0.3, 0.5}}}
+
+	var o map[string]interface{}
+	for _, input := range []string{
+		`{"retries": 3, "ratio": 0.5}`,
+		`{"retries": 5.0, "ratio": 0.30000000000000004}`,
+		`{}`,
+	} {
+		noErr(t, UnmarshalX([]byte(input), &o, cfg))
+	}
+
+	testErrors(t, UnmarshalX([]byte(`{"retries": 2, "ratio": 0.3}`), &o, cfg),
+		NewValidationError(InvalidEnum, "/retries", "must be one of 1, 3, 5"))
+	testErrors(t, UnmarshalX([]byte(`{"retries": "3", "ratio": 0.4}`), &o, cfg),
+		NewValidationError(InvalidEnum, "/ratio", "must be one of 0.3, 0.5"),
+		NewValidationError(TypeMismatch, "/retries", "want number, got string"))
+}
+
+func TestRequiredIf(t *testing.T) {
+	cfg := &Options{Required: []string{"host"}, RequiredIf: []ConditionalRequirement{
+		{Trigger: "tls", TriggerValue: json.RawMessage(`true`), Keys: []string{"cert", "key"}},
+		{Trigger: "auth", TriggerValue: json.RawMessage(`"password"`), Keys: []string{"host", "user"}},
+	}}
+
+	var o map[string]interface{}
+	for _, input := range []string{
+		`{"host": "h", "tls": true, "cert": "c", "key": "k"}`,
+		`{"host": "h", "tls": false}`,
+		`{"host": "h", "tls": "true"}`,
+		`{"host": "h", "auth": "password", "user": "u"}`,
+	} {
+		noErr(t, UnmarshalX([]byte(input), &o, cfg))
+	}
+
+	testErrors(t, UnmarshalX([]byte(`{"host": "h", "tls": true, "key": "k"}`), &o, cfg),
+		NewMissingKeyError("/cert"))
+	// host is only reported once though both rules require it
+	testErrors(t, UnmarshalX([]byte(`{"auth": "password", "tls": true}`), &o, cfg),
+		NewMissingKeyError("/host"),
+		NewMissingKeyError("/cert"),
+		NewMissingKeyError("/key"),
+		NewMissingKeyError("/user"))
+}
+
+func TestCaptureForbiddenValues(t *testing.T) {
+	input := []byte(`{"admin": true, "password": "hunter2", "debug": null}`)
+	cfg := &Options{Forbidden: []string{"admin", "debug", "password"}}
+
+	var o map[string]interface{}
+	testErrors(t, UnmarshalX(input, &o, cfg),
+		NewForbiddenKeyError("/admin"),
+		NewForbiddenKeyError("/debug"),
+		NewForbiddenKeyError("/password"))
+
+	cfg.CaptureForbiddenValues = true
+	cfg.RedactKeys = []string{"password"}
+	cfg.InternKeys = true
+	admin, debug, password := NewForbiddenKeyError("/admin"), NewForbiddenKeyError("/debug"), NewForbiddenKeyError("/password")
+	admin.Value = json.RawMessage(`true`)
+	debug.Value = json.RawMessage(`null`)
+	password.Value = json.RawMessage(`"[redacted]"`)
+	e := UnmarshalX(input, &o, cfg)
+	testErrors(t, e, admin, debug, password)
+
+	// captured values don't alias the input
+	copy(input, bytes.Repeat([]byte(" "), len(input)))
+	testErrors(t, e, admin, debug, password)
+}
+
+func TestMarshalX(t *testing.T) {
+	cfg := &Options{Required: []string{"foo"}, Forbidden: []string{"secret"}}
+
+	i := 1
+	got, err := MarshalX(TestStruct{"a", &i}, cfg)
+	noErr(t, err)
+	if want := `{"foo":"a","bar":1}`; string(got) != want {
+		t.Errorf("got: %s, want: %s", got, want)
+	}
+
+	cfg.NullNotPresent = []string{"foo"}
+	got, err = MarshalX(map[string]interface{}{"foo": nil, "secret": "x"}, cfg)
+	testErrors(t, err, NewMissingKeyError("/foo"), NewForbiddenKeyError("/secret"))
+	if got != nil {
+		t.Errorf("got: %s, want: no bytes", got)
+	}
+
+	got, err = MarshalX(TestStruct{"a", nil}, &Options{StripNulls: true})
+	noErr(t, err)
+	if want := `{"foo":"a"}`; string(got) != want {
+		t.Errorf("got: %s, want: %s", got, want)
+	}
+}
+
+func TestMarshalXRequireNonEmpty(t *testing.T) {
+	cfg := &Options{RequireNonEmptyOnMarshal: []string{"foo", "bar"}}
+
+	i := 0
+	got, err := MarshalX(TestStruct{"a", &i}, cfg)
+	noErr(t, err)
+	if want := `{"foo":"a","bar":0}`; string(got) != want {
+		t.Errorf("got: %s, want: %s", got, want)
+	}
+
+	got, err = MarshalX(&TestStruct{}, cfg)
+	testErrors(t, err, NewMissingKeyError("/foo"), NewMissingKeyError("/bar"))
+	if got != nil {
+		t.Errorf("got: %s, want: no bytes", got)
+	}
+
+	// promoted fields and map entries are found by their json names
+	cfg.RequireNonEmptyOnMarshal = []string{"id", "name"}
+	_, err = MarshalX(strictStruct{Name: "n"}, cfg)
+	testErrors(t, err, NewMissingKeyError("/id"))
+	_, err = MarshalX(map[string]interface{}{"id": "1", "name": []string{}}, cfg)
+	testErrors(t, err, NewMissingKeyError("/name"))
+}
+
+func TestUnmarshalXContext(t *testing.T) {
+	cfg := &Options{Required: []string{"foo"}}
+
+	var o TestStruct
+	noErr(t, UnmarshalXContext(context.Background(), []byte(`{"foo": "a"}`), &o, cfg))
+	testErrors(t, UnmarshalXContext(context.Background(), []byte(`{}`), &o, cfg), NewMissingKeyError("/foo"))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	o = TestStruct{}
+	for _, opts := range []*Options{cfg, nil} {
+		if err := UnmarshalXContext(ctx, []byte(`{"foo": "b"}`), &o, opts); err != context.Canceled {
+			t.Errorf("got: %v, want: %v", err, context.Canceled)
+		}
+	}
+
+	// cancelling partway through validation stops before decoding
+	ctx, cancel = context.WithCancel(context.Background())
+	decoded := false
+	cfg = &Options{
+		Strict: true,
+		UnknownFieldHandler: func(string, json.RawMessage) error {
+			cancel()
+			return nil
+		},
+		Decode: func([]byte, interface{}) error {
+			decoded = true
+			return nil
+		},
+	}
+	if err := UnmarshalXContext(ctx, []byte(`{"foo": "c", "zed": 1, "zoo": 2}`), &o, cfg); err != context.Canceled {
+		t.Errorf("got: %v, want: %v", err, context.Canceled)
+	}
+	if decoded || o.Foo != "" {
+		t.Errorf("got: %+v decoded, want: v left untouched", o)
+	}
+}
+
+func TestUnmarshalXDefaults(t *testing.T) {
+	type config struct {
+		Host    string `json:"host"`
+		Port    int    `json:"port"`
+		Retries int    `json:"retries"`
+	}
+	cfg := &Options{
+		Required:       []string{"host"},
+		NullNotPresent: []string{"retries"},
+		Defaults:       map[string]json.RawMessage{"port": json.RawMessage(`8080`), "retries": json.RawMessage(`3`)},
+	}
+
+	var o config
+	noErr(t, UnmarshalX([]byte(`{"host": "h"}`), &o, cfg))
+	if want := (config{"h", 8080, 3}); o != want {
+		t.Errorf("got: %+v, want: %+v", o, want)
+	}
+
+	o = config{}
+	noErr(t, UnmarshalX([]byte(`{"host": "h", "port": 443, "retries": null}`), &o, cfg))
+	if want := (config{"h", 443, 3}); o != want {
+		t.Errorf("got: %+v, want: %+v", o, want)
+	}
+
+	var list []config
+	noErr(t, UnmarshalX([]byte(`[{"host": "a"}, {"host": "b", "port": 1}]`), &list, cfg))
+	if want := []config{{"a", 8080, 3}, {"b", 1, 3}}; !reflect.DeepEqual(list, want) {
+		t.Errorf("got: %+v, want: %+v", list, want)
+	}
+
+	testErrors(t, UnmarshalX([]byte(`{"port": 1}`), &o, cfg), NewMissingKeyError("/host"))
+
+	for _, opts := range []*Options{
+		{Required: []string{"port"}, Defaults: cfg.Defaults},
+		{Forbidden: []string{"port"}, Defaults: cfg.Defaults},
+		{Defaults: map[string]json.RawMessage{"port": json.RawMessage(`{`)}},
+	} {
+		if e := UnmarshalX([]byte(`{}`), &o, opts); !isConfigError(e) {
+			t.Errorf("got: %v, want: ConfigError", e)
+		}
+	}
+}
+
+func TestUnmarshalXOnSuccess(t *testing.T) {
+	var called []string
+	cfg := &Options{Required: []string{"foo"}, OnSuccess: func(v interface{}) {
+		called = append(called, v.(*TestStruct).Foo)
+	}}
+
+	var o TestStruct
+	noErr(t, UnmarshalX([]byte(`{"foo": "a"}`), &o, cfg))
+	testErrors(t, UnmarshalX([]byte(`{"bar": 1}`), &o, cfg), NewMissingKeyError("/foo"))
+	if err := UnmarshalX([]byte(`{"foo": 1}`), &o, cfg); err == nil {
+		t.Errorf("got: no error, want: a decode error")
+	}
+	noErr(t, UnmarshalAll([]byte(`{"foo": "b"}`), &o, cfg, &Options{}))
+
+	if want := []string{"a", "b"}; !reflect.DeepEqual(called, want) {
+		t.Errorf("got: %v, want: %v", called, want)
+	}
+}
+
+func TestIndentValidated(t *testing.T) {
+	cfg := &Options{Required: []string{"foo"}}
+
+	var o TestStruct
+	got, err := IndentValidated([]byte(`{"foo": "a","bar":1}`), &o, cfg, "", "  ")
+	noErr(t, err)
+	if want := "{\n  \"foo\": \"a\",\n  \"bar\": 1\n}"; string(got) != want {
+		t.Errorf("got: %s, want: %s", got, want)
+	}
+	i := 1
+	testTS(t, o, TestStruct{"a", &i})
+
+	got, err = IndentValidated([]byte(`{"bar": 1}`), &o, cfg, "", "  ")
+	testErrors(t, err, NewMissingKeyError("/foo"))
+	if got != nil {
+		t.Errorf("got: %s, want: no bytes", got)
+	}
+}
+
+func TestValidationErrorValueMessage(t *testing.T) {
+	cfg := &Options{Forbidden: []string{"admin", "note"}, CaptureForbiddenValues: true}
+	input := []byte(`{"admin": true, "note": "ééééééééééééééééééé"}`)
+
+	var o map[string]interface{}
+	var got []string
+	for _, ve := range UnmarshalErrors(input, &o, cfg) {
+		got = append(got, ve.Error())
+	}
+	want := []string{
+		"forbidden key <admin> was set with value true",
+		`forbidden key <note> was set with value "ééééééééééééééé...`,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got: %q, want: %q", got, want)
+	}
+
+	// without capturing the message is unchanged
+	cfg.CaptureForbiddenValues = false
+	if got := UnmarshalErrors(input, &o, cfg)[0].Error(); got != "forbidden key <admin> was set" {
+		t.Errorf("got: %q", got)
+	}
+}
+
+func TestUnmarshalAll(t *testing.T) {
+	base := &Options{Required: []string{"foo"}}
+	overlay := &Options{Forbidden: []string{"bar"}}
+
+	var o TestStruct
+	noErr(t, UnmarshalAll([]byte(`{"foo": "a"}`), &o, base, overlay))
+	if o.Foo != "a" {
+		t.Errorf("got: %q, want: a", o.Foo)
+	}
+
+	input := []byte(`{"bar": 1}`)
+	testErrors(t, UnmarshalAll(input, &o, base, nil, overlay),
+		NewMissingKeyError("/foo"),
+		NewForbiddenKeyError("/bar"))
+
+	base.FailFast = true
+	testErrors(t, UnmarshalAll(input, &o, base, overlay), NewMissingKeyError("/foo"))
+
+	if err := UnmarshalAll([]byte(`{`), &o, base, overlay); err == nil {
+		t.Error("got: nil, want: syntax error")
+	}
+}
+
+func TestUnmarshalXTypes(t *testing.T) {
+	cfg := &Options{Types: map[string]string{
+		"host": "string", "port": "number", "tls": "boolean", "tags": "array", "meta": "object",
+	}}
+
+	var o map[string]interface{}
+	noErr(t, UnmarshalX([]byte(`{"host": "h", "port": 80, "tls": false, "tags": [], "meta": {}}`), &o, cfg))
+	noErr(t, UnmarshalX([]byte(`{"host": null}`), &o, cfg))
+
+	cfg.NullNotPresent = []string{"host"}
+	e := UnmarshalX([]byte(`{"host": null, "port": "80", "tls": 1, "tags": {}, "meta": []}`), &o, cfg)
+	testErrors(t, e,
+		NewValidationError(TypeMismatch, "/host", "want string, got null"),
+		NewValidationError(TypeMismatch, "/meta", "want object, got array"),
+		NewValidationError(TypeMismatch, "/port", "want number, got string"),
+		NewValidationError(TypeMismatch, "/tags", "want array, got object"),
+		NewValidationError(TypeMismatch, "/tls", "want boolean, got number"))
+
+	cfg.Types["x"] = "integer"
+	if e := UnmarshalX([]byte(`{}`), &o, cfg); !isConfigError(e) {
+		t.Errorf("got: %v, want: ConfigError", e)
+	}
+}
+
+func TestUnmarshalXMinMax(t *testing.T) {
+	cfg := &Options{
+		Min: map[string]float64{"port": 1, "ratio": 0},
+		Max: map[string]float64{"port": 65535, "retries": 10},
+	}
+
+	var o map[string]interface{}
+	noErr(t, UnmarshalX([]byte(`{"port": 1, "ratio": 0.5, "retries": -3}`), &o, cfg))
+	noErr(t, UnmarshalX([]byte(`{"port": 65535, "ratio": null}`), &o, cfg))
+
+	e := UnmarshalX([]byte(`{"port": 0, "ratio": "half", "retries": 11}`), &o, cfg)
+	testErrors(t, e,
+		NewValidationError(OutOfRange, "/port", "must be at least 1"),
+		NewValidationError(TypeMismatch, "/ratio", "want number, got string"),
+		NewValidationError(OutOfRange, "/retries", "must be at most 10"))
+}
+
+func TestUnmarshalXMinMaxExact(t *testing.T) {
+	// 2^99, which float64 holds exactly, and its neighbours, which it doesn't
+	bound := math.Ldexp(1, 99)
+	cfg := &Options{Min: map[string]float64{"low": bound}, Max: map[string]float64{"high": bound}}
+
+	var o map[string]json.Number
+	noErr(t, UnmarshalX([]byte(`{"low": 633825300114114700748351602688, "high": 633825300114114700748351602688}`), &o, cfg))
+
+	e := UnmarshalX([]byte(`{"low": 633825300114114700748351602687, "high": 633825300114114700748351602689}`), &o, cfg)
+	testErrors(t, e,
+		NewValidationError(OutOfRange, "/high", fmt.Sprintf("must be at most %v", bound)),
+		NewValidationError(OutOfRange, "/low", fmt.Sprintf("must be at least %v", bound)))
+}
+
+func TestUnmarshalXMaxDuration(t *testing.T) {
+	cfg := &Options{Max: map[string]float64{"timeout": 1e30, "retries": 1e30}}
+
+	var o struct {
+		Timeout time.Duration `json:"timeout"`
+		Retries *uint8
+	}
+	noErr(t, UnmarshalX([]byte(`{"timeout": 9223372036854775807, "retries": 255}`), &o, cfg))
+	if o.Timeout != math.MaxInt64 || *o.Retries != 255 {
+		t.Errorf("got: %v, %v", o.Timeout, *o.Retries)
+	}
+
+	e := UnmarshalX([]byte(`{"timeout": 9223372036854775808, "retries": 256}`), &o, cfg)
+	testErrors(t, e,
+		NewValidationError(OutOfRange, "/retries", "must be between 0 and 255 to fit uint8"),
+		NewValidationError(OutOfRange, "/timeout", "must be between -9223372036854775808 and 9223372036854775807 to fit time.Duration"))
+
+	// the bound itself is still applied first
+	var m map[string]int64
+	testErrors(t, UnmarshalX([]byte(`{"timeout": 1e31}`), &m, cfg),
+		NewValidationError(OutOfRange, "/timeout", "must be at most 1e+30"))
+	noErr(t, UnmarshalX([]byte(`{"timeout": 1}`), &m, cfg))
+}
+
+func TestUnmarshalXPatternAnyOf(t *testing.T) {
+	cfg := &Options{PatternAnyOf: map[string][]string{
+		"id": {`^[0-9]+$`, `^[a-f0-9]{8}-[a-f0-9]{4}$`},
+	}}
+
+	var o map[string]interface{}
+	noErr(t, UnmarshalX([]byte(`{"id": "1234"}`), &o, cfg))
+	// matches only the second pattern
+	noErr(t, UnmarshalX([]byte(`{"id": "deadbeef-0123"}`), &o, cfg))
+
+	testErrors(t, UnmarshalX([]byte(`{"id": "abc"}`), &o, cfg),
+		NewValidationError(PatternMismatch, "/id", `matches none of ^[0-9]+$, ^[a-f0-9]{8}-[a-f0-9]{4}$`))
+	testErrors(t, UnmarshalX([]byte(`{"id": 1234}`), &o, cfg),
+		NewValidationError(TypeMismatch, "/id", "want string, got number"))
+
+	cfg.PatternAnyOf["bad"] = []string{"("}
+	if e := UnmarshalX([]byte(`{}`), &o, cfg); !isConfigError(e) {
+		t.Errorf("got: %v, want: ConfigError", e)
+	}
+}
+
+func TestUnmarshalXStringLength(t *testing.T) {
+	cfg := &Options{
+		MinLength: map[string]int{"name": 2},
+		MaxLength: map[string]int{"name": 4, "code": 3},
+	}
+
+	var o map[string]interface{}
+	// multi-byte characters are counted once
+	noErr(t, UnmarshalX([]byte(`{"name": "日本語語", "code": "€€€"}`), &o, cfg))
+
+	e := UnmarshalX([]byte(`{"name": "é", "code": "abcd"}`), &o, cfg)
+	testErrors(t, e,
+		NewValidationError(LengthViolation, "/code", "length 4 exceeds the maximum of 3"),
+		NewValidationError(LengthViolation, "/name", "length 1 is below the minimum of 2"))
+
+	testErrors(t, UnmarshalX([]byte(`{"name": ["ab"]}`), &o, cfg),
+		NewValidationError(TypeMismatch, "/name", "want string, got array"))
+}
+
+func TestUnmarshalXStringLengthMode(t *testing.T) {
+	cfg := &Options{MaxLength: map[string]int{"name": 4}}
+
+	var o map[string]interface{}
+	input := []byte(`{"name": "café"}`)
+	noErr(t, UnmarshalX(input, &o, cfg))
+
+	cfg.LengthMode = Bytes
+	testErrors(t, UnmarshalX(input, &o, cfg),
+		NewValidationError(LengthViolation, "/name", "length 5 bytes exceeds the maximum of 4"))
+	noErr(t, UnmarshalX([]byte(`{"name": "cafe"}`), &o, cfg))
+}
+
+func TestUnmarshalXRequiredNonEmpty(t *testing.T) {
+	cfg := &Options{RequiredNonEmpty: []string{"a", "b", "c", "d", "e"}}
+
+	var o map[string]interface{}
+	noErr(t, UnmarshalX([]byte(`{"a": "x", "b": [0], "c": {"k": null}, "d": 0, "e": false}`), &o, cfg))
+
+	e := UnmarshalX([]byte(`{"a": null, "b": "", "c": [ ], "d": { }}`), &o, cfg)
+	testErrors(t, e,
+		NewValidationError(MissingKey, "/a", "empty"),
+		NewValidationError(MissingKey, "/b", "empty"),
+		NewValidationError(MissingKey, "/c", "empty"),
+		NewValidationError(MissingKey, "/d", "empty"),
+		NewMissingKeyError("/e"))
+
+	if got, want := e.(ErrorCollection).errors[1].Error(), "required key <b> was empty"; got != want {
+		t.Errorf("got: %q, want: %q", got, want)
+	}
+}
+
+func TestUnmarshalXRequiredNonEmptyNested(t *testing.T) {
+	cfg := &Options{RequiredNonEmpty: []string{"server.host", "server.tags"}}
+
+	var o map[string]interface{}
+	noErr(t, UnmarshalX([]byte(`{"server": {"host": "h", "tags": ["a"]}}`), &o, cfg))
+
+	e := UnmarshalX([]byte(`{"server": {"host": ""}}`), &o, cfg)
+	testErrors(t, e,
+		NewValidationError(MissingKey, "/server/host", "empty"),
+		NewMissingKeyError("/server/tags"))
+	if got, want := e.(ErrorCollection).errors[0].Error(), "required key <server.host> was empty"; got != want {
+		t.Errorf("got: %q, want: %q", got, want)
+	}
+}
+
+func TestUnmarshalXPattern(t *testing.T) {
+	cfg := &Options{Pattern: map[string]string{"email": `^[^@\s]+@[^@\s]+$`}}
+
+	var o map[string]interface{}
+	noErr(t, UnmarshalX([]byte(`{"email": "a@example.com"}`), &o, cfg))
+	noErr(t, UnmarshalX([]byte(`{"other": "x"}`), &o, cfg))
+
+	testErrors(t, UnmarshalX([]byte(`{"email": "nope"}`), &o, cfg),
+		NewValidationError(PatternMismatch, "/email", `does not match ^[^@\s]+@[^@\s]+$`))
+	testErrors(t, UnmarshalX([]byte(`{"email": true}`), &o, cfg),
+		NewValidationError(TypeMismatch, "/email", "want string, got boolean"))
+
+	cfg.Pattern["bad"] = "[a-"
+	if e := UnmarshalX([]byte(`{}`), &o, cfg); !isConfigError(e) {
+		t.Errorf("got: %v, want: ConfigError", e)
+	}
+}
+
+func TestUnmarshalXMaxPatternInputBytes(t *testing.T) {
+	cfg := &Options{
+		Pattern:              map[string]string{"email": `^[^@\s]+@[^@\s]+$`},
+		PatternAnyOf:         map[string][]string{"id": {`^[0-9]+$`}},
+		MaxPatternInputBytes: 16,
+	}
+
+	var o map[string]interface{}
+	noErr(t, UnmarshalX([]byte(`{"email": "a@example.com", "id": "1234"}`), &o, cfg))
+
+	long := strings.Repeat("a", 1<<20) + "@example.com"
+	e := UnmarshalX([]byte(`{"email": "`+long+`", "id": "12345678901234567"}`), &o, cfg)
+	testErrors(t, e,
+		NewValidationError(PatternMismatch, "/email", fmt.Sprintf("%d bytes exceeds the maximum of 16 checked against a pattern", len(long))),
+		NewValidationError(PatternMismatch, "/id", "17 bytes exceeds the maximum of 16 checked against a pattern"))
+}
+
+func TestUnmarshalXUnknownFieldHandler(t *testing.T) {
+	var seen []string
+	cfg := &Options{UnknownFieldHandler: func(key string, raw json.RawMessage) error {
+		seen = append(seen, key+"="+string(raw))
+		switch key {
+		case "comment":
+			return nil
+		case "legacy":
+			return NewValidationError(ForbiddenKey, "/legacy", "")
+		}
+		return fmt.Errorf("not supported")
+	}}
+
+	var o strictStruct
+	noErr(t, UnmarshalX([]byte(`{"id": "1", "comment": "hi"}`), &o, cfg))
+
+	seen = nil
+	e := UnmarshalX([]byte(`{"id": "1", "comment": "hi", "legacy": null, "zed": 2}`), &o, cfg)
+	testErrors(t, e,
+		NewForbiddenKeyError("/legacy"),
+		NewValidationError(UnknownKey, "/zed", "not supported"))
+	if want := []string{`comment="hi"`, "legacy=null", "zed=2"}; !reflect.DeepEqual(seen, want) {
+		t.Errorf("got: %v, want: %v", seen, want)
+	}
+	if got, want := e.(ErrorCollection).errors[1].Error(), "unknown key <zed> is not a field of the destination: not supported"; got != want {
+		t.Errorf("got: %q, want: %q", got, want)
+	}
+}
+
+func TestUnmarshalXEnum(t *testing.T) {
+	cfg := &Options{Enum: map[string][]string{
+		"env":   {"dev", "staging", "prod"},
+		"level": {"1", "2", "null"},
+	}}
+
+	var o map[string]interface{}
+	noErr(t, UnmarshalX([]byte(`{"env": "prod", "level": 2}`), &o, cfg))
+	noErr(t, UnmarshalX([]byte(`{"level": null}`), &o, cfg))
+
+	e := UnmarshalX([]byte(`{"env": "test", "level": 3}`), &o, cfg)
+	testErrors(t, e,
+		NewValidationError(NotInEnum, "/env", "dev, staging, prod"),
+		NewValidationError(NotInEnum, "/level", "1, 2, null"))
+	if got, want := e.(ErrorCollection).errors[0].Error(),
+		"key <env> is not one of the allowed values: dev, staging, prod"; got != want {
+		t.Errorf("got: %q, want: %q", got, want)
+	}
+
+	testErrors(t, UnmarshalX([]byte(`{"env": ["dev"]}`), &o, cfg),
+		NewValidationError(NotInEnum, "/env", "dev, staging, prod"))
+}
+
+func TestUnmarshalXEnumCaseInsensitive(t *testing.T) {
+	cfg := &Options{Enum: map[string][]string{"country": {"us", "gb"}}}
+
+	var o map[string]interface{}
+	e := UnmarshalX([]byte(`{"country": "Us"}`), &o, cfg)
+	testErrors(t, e, NewValidationError(NotInEnum, "/country", "us, gb"))
+
+	cfg.EnumCaseInsensitive = true
+	noErr(t, UnmarshalX([]byte(`{"country": "Us"}`), &o, cfg))
+	noErr(t, UnmarshalX([]byte(`{"country": "GB"}`), &o, cfg))
+	testErrors(t, UnmarshalX([]byte(`{"country": "FR"}`), &o, cfg),
+		NewValidationError(NotInEnum, "/country", "us, gb"))
+}
+
+func TestUnmarshalXVerifyRoundTrip(t *testing.T) {
+	cfg := &Options{VerifyRoundTrip: true}
+
+	var o TestStruct
+	noErr(t, UnmarshalX([]byte(`{"bar": 1, "foo": "a"}`), &o, cfg))
+
+	e := UnmarshalX([]byte(`{"foo": "a", "bar": 1, "extra": true}`), &o, cfg)
+	testErrors(t, e, NewValidationError(RoundTripMismatch, "", "keys differ: extra"))
+
+	// keys removed by StripNulls aren't expected back
+	noErr(t, UnmarshalX([]byte(`{"foo": "a", "bar": 1, "extra": null}`), &o, &Options{VerifyRoundTrip: true, StripNulls: true}))
+}
+
+func TestUnmarshalXVerifyRoundTripOmittedFields(t *testing.T) {
+	cfg := &Options{VerifyRoundTrip: true}
+
+	// fields the input doesn't set, however deeply nested, are not compared
+	var o struct {
+		Foo   string       `json:"foo"`
+		Count int          `json:"count"`
+		Inner strictStruct `json:"inner"`
+		List  []TestStruct `json:"list"`
+	}
+	noErr(t, UnmarshalX([]byte(`{"foo": "a", "inner": {"name": "n"}, "list": [{"foo": "x"}]}`), &o, cfg))
+
+	e := UnmarshalX([]byte(`{"foo": "a", "inner": {"name": "n", "zed": 1}}`), &o, cfg)
+	testErrors(t, e, NewValidationError(RoundTripMismatch, "", "keys differ: inner"))
+}
+
+func TestValidationErrorFullKey(t *testing.T) {
+	input := []byte(`{"servers": [{"host": "a"}, {"host": "b"}, {"port": 1}], "tls": {}}`)
+	cfg := &Options{ApplyRecursively: true, Forbidden: []string{"port"}, FieldOptions: map[string]*Options{
+		"tls": {Required: []string{"cert"}, AtLeastNOf: []KeyGroup{{Keys: []string{"user", "token"}, N: 1}}},
+	}}
+
+	var o map[string]interface{}
+	var got []string
+	for _, ve := range UnmarshalErrors(input, &o, cfg) {
+		got = append(got, ve.Key+": "+ve.Error())
+	}
+	want := []string{
+		"tls.cert: required key <tls.cert> not found",
+		"tls.user,token: not enough of keys <tls.user,token> were set: 0 present, 1 required",
+		"servers[2].port: forbidden key <servers[2].port> was set",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got: %q, want: %q", got, want)
+	}
+}
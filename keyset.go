@@ -0,0 +1,61 @@
+package json
+
+import "sort"
+
+// KeySet is a set of keys for building the key lists held by Options, such as
+// Required or Forbidden, without accidentally repeating a key. It may be
+// assigned to Options.RequiredSet or Options.ForbiddenSet, or its Slice to any
+// key list. The zero value is an empty set ready to use, and a nil *KeySet
+// reads as an empty set.
+type KeySet struct {
+	keys map[string]bool
+}
+
+// NewKeySet returns a KeySet holding keys.
+func NewKeySet(keys ...string) *KeySet {
+	ks := &KeySet{}
+	ks.Add(keys...)
+	return ks
+}
+
+// Add adds keys to the set. There is nowhere to add them to a nil *KeySet, so
+// it panics.
+func (ks *KeySet) Add(keys ...string) {
+	if ks == nil {
+		panic("json: Add called on a nil *KeySet")
+	}
+	if ks.keys == nil {
+		ks.keys = map[string]bool{}
+	}
+	for _, k := range keys {
+		ks.keys[k] = true
+	}
+}
+
+// Remove removes keys from the set.
+func (ks *KeySet) Remove(keys ...string) {
+	if ks == nil {
+		return
+	}
+	for _, k := range keys {
+		delete(ks.keys, k)
+	}
+}
+
+// Has reports if k is in the set.
+func (ks *KeySet) Has(k string) bool {
+	return ks != nil && ks.keys[k]
+}
+
+// Slice returns the keys in the set, sorted, for assigning to Options.
+func (ks *KeySet) Slice() []string {
+	if ks == nil {
+		return []string{}
+	}
+	s := make([]string, 0, len(ks.keys))
+	for k := range ks.keys {
+		s = append(s, k)
+	}
+	sort.Strings(s)
+	return s
+}
@@ -0,0 +1,66 @@
+package json
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestKeySet(t *testing.T) {
+	var ks KeySet
+	if ks.Has("foo") || len(ks.Slice()) != 0 {
+		t.Errorf("got: %v, want: empty set", ks.Slice())
+	}
+
+	ks.Add("foo", "bar", "foo", "baz")
+	ks.Remove("baz", "missing")
+	if !ks.Has("foo") || ks.Has("baz") {
+		t.Errorf("got: %v, want: [bar foo]", ks.Slice())
+	}
+	if want := []string{"bar", "foo"}; !reflect.DeepEqual(ks.Slice(), want) {
+		t.Errorf("got: %v, want: %v", ks.Slice(), want)
+	}
+}
+
+func TestKeySetOptions(t *testing.T) {
+	required := NewKeySet("foo", "bar")
+	required.Add("foo")
+
+	o := TestStruct{}
+	e := UnmarshalX([]byte(`{"bar": 4444}`), &o, &Options{Required: required.Slice()})
+	testErrors(t, e, ValidationError{Type: MissingKey, Key: "foo", Path: "/foo", PathSegments: []string{"foo"}})
+}
+
+func TestKeySetNil(t *testing.T) {
+	var ks *KeySet
+	ks.Remove("foo")
+	if ks.Has("foo") || len(ks.Slice()) != 0 {
+		t.Errorf("got: %v, want: empty set", ks.Slice())
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Errorf("got: no panic, want: Add on a nil *KeySet to panic")
+		}
+	}()
+	ks.Add("foo")
+}
+
+func TestKeySetOptionsFields(t *testing.T) {
+	cfg := &Options{
+		Required:     []string{"foo"},
+		RequiredSet:  NewKeySet("foo", "baz"),
+		ForbiddenSet: NewKeySet("secret"),
+	}
+
+	o := TestStruct{}
+	e := UnmarshalX([]byte(`{"bar": 1, "secret": 2}`), &o, cfg)
+	testErrors(t, e, NewMissingKeyError("/foo"), NewMissingKeyError("/baz"), NewForbiddenKeyError("/secret"))
+	if want := []string{"foo"}; !reflect.DeepEqual(cfg.Required, want) {
+		t.Errorf("got: %v, want: Required left as %v", cfg.Required, want)
+	}
+
+	cfg.ForbiddenSet.Add("foo")
+	if e := UnmarshalX([]byte(`{}`), &o, cfg); !isConfigError(e) {
+		t.Errorf("got: %v, want: ConfigError", e)
+	}
+}
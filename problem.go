@@ -0,0 +1,98 @@
+package json
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// statusText holds the reason phrases for the HTTP client and server error
+// statuses a problem may be reported with, as net/http.StatusText gives them,
+// so that net/http needn't be imported for them.
+var statusText = map[int]string{
+	400: "Bad Request",
+	401: "Unauthorized",
+	402: "Payment Required",
+	403: "Forbidden",
+	404: "Not Found",
+	405: "Method Not Allowed",
+	406: "Not Acceptable",
+	407: "Proxy Authentication Required",
+	408: "Request Timeout",
+	409: "Conflict",
+	410: "Gone",
+	411: "Length Required",
+	412: "Precondition Failed",
+	413: "Request Entity Too Large",
+	414: "Request URI Too Long",
+	415: "Unsupported Media Type",
+	416: "Requested Range Not Satisfiable",
+	417: "Expectation Failed",
+	418: "I'm a teapot",
+	421: "Misdirected Request",
+	422: "Unprocessable Entity",
+	423: "Locked",
+	424: "Failed Dependency",
+	425: "Too Early",
+	426: "Upgrade Required",
+	428: "Precondition Required",
+	429: "Too Many Requests",
+	431: "Request Header Fields Too Large",
+	451: "Unavailable For Legal Reasons",
+
+	500: "Internal Server Error",
+	501: "Not Implemented",
+	502: "Bad Gateway",
+	503: "Service Unavailable",
+	504: "Gateway Timeout",
+	505: "HTTP Version Not Supported",
+	506: "Variant Also Negotiates",
+	507: "Insufficient Storage",
+	508: "Loop Detected",
+	510: "Not Extended",
+	511: "Network Authentication Required",
+}
+
+// problem is an RFC 7807 problem details object extended with the individual
+// validation errors.
+type problem struct {
+	Type   string         `json:"type"`
+	Title  string         `json:"title,omitempty"`
+	Status int            `json:"status"`
+	Detail string         `json:"detail"`
+	Errors []problemError `json:"errors"`
+}
+
+type problemError struct {
+	Type    string `json:"type"`
+	Key     string `json:"key,omitempty"`
+	Path    string `json:"path,omitempty"`
+	Detail  string `json:"detail,omitempty"`
+	Message string `json:"message"`
+}
+
+// ProblemJSON renders the collection as an RFC 7807 application/problem+json
+// body for an HTTP response with the given status code. The individual
+// validation errors are listed under an "errors" member. The title is the
+// status's reason phrase, and is left out for a status that has none.
+func (e ErrorCollection) ProblemJSON(status int) []byte {
+	p := problem{
+		Type:   "about:blank",
+		Title:  statusText[status],
+		Status: status,
+		Detail: fmt.Sprintf("%d validation error(s)", len(e.errors)),
+		Errors: make([]problemError, len(e.errors)),
+	}
+	for i, ve := range e.errors {
+		p.Errors[i] = problemError{
+			Type:    ve.Type.String(),
+			Key:     ve.Key,
+			Path:    ve.Path,
+			Detail:  ve.Detail,
+			Message: ve.Error(),
+		}
+	}
+
+	// a problem holds nothing that can fail to marshal
+	b, _ := json.Marshal(p)
+	return b
+}
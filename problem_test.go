@@ -0,0 +1,71 @@
+package json
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestErrorCollectionProblemJSON(t *testing.T) {
+	errs := ErrorCollection{errors: []ValidationError{
+		{Type: MissingKey, Key: "foo", Path: "/foo", PathSegments: []string{"foo"}},
+		{Type: OutOfRange, Key: "bar", Path: "/bar", PathSegments: []string{"bar"}, Detail: "must be a number greater than 0"},
+	}}
+
+	var got map[string]interface{}
+	noErr(t, json.Unmarshal(errs.ProblemJSON(422), &got))
+
+	want := map[string]interface{}{
+		"type":   "about:blank",
+		"title":  "Unprocessable Entity",
+		"status": float64(422),
+		"detail": "2 validation error(s)",
+		"errors": []interface{}{
+			map[string]interface{}{
+				"type":    "MissingKey",
+				"key":     "foo",
+				"path":    "/foo",
+				"message": "required key <foo> not found",
+			},
+			map[string]interface{}{
+				"type":    "OutOfRange",
+				"key":     "bar",
+				"path":    "/bar",
+				"detail":  "must be a number greater than 0",
+				"message": "key <bar> is out of range: must be a number greater than 0",
+			},
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got: %#v, want: %#v", got, want)
+	}
+}
+
+func TestValidationErrorTypeString(t *testing.T) {
+	if got := ForbiddenKey.String(); got != "ForbiddenKey" {
+		t.Errorf("got: %v, want: ForbiddenKey", got)
+	}
+	if got := ValidationErrorType(-1).String(); got != "ValidationErrorType(-1)" {
+		t.Errorf("got: %v, want: ValidationErrorType(-1)", got)
+	}
+}
+
+func TestErrorCollectionProblemJSONStatus(t *testing.T) {
+	errs := ErrorCollection{errors: []ValidationError{{Type: MissingKey, Key: "foo"}}}
+
+	// every client and server error status has the title net/http gives it
+	for status := 400; status < 600; status++ {
+		var got map[string]interface{}
+		noErr(t, json.Unmarshal(errs.ProblemJSON(status), &got))
+		if got["status"] != float64(status) {
+			t.Errorf("got: %v, want: %d", got["status"], status)
+		}
+		title, ok := got["title"]
+		if want := http.StatusText(status); want == "" && ok {
+			t.Errorf("%d: got: %q, want: no title", status, title)
+		} else if want != "" && title != want {
+			t.Errorf("%d: got: %q, want: %q", status, title, want)
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package json
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+)
+
+// registry maps the names given to RegisterType to their types.
+var registry = struct {
+	sync.RWMutex
+	types map[string]reflect.Type
+}{types: map[string]reflect.Type{}}
+
+// RegisterType records the type of sample under name so that UnmarshalTyped
+// can decode into it. sample may be a value or a pointer to one; either way
+// UnmarshalTyped returns a pointer to a new instance. Registering a name twice
+// with different types panics.
+func RegisterType(name string, sample interface{}) {
+	t := reflect.TypeOf(sample)
+	if t == nil {
+		panic("json: RegisterType of nil sample")
+	}
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	registry.Lock()
+	defer registry.Unlock()
+	if prev, ok := registry.types[name]; ok && prev != t {
+		panic(fmt.Sprintf("json: RegisterType %q for %v, already registered for %v", name, t, prev))
+	}
+	registry.types[name] = t
+}
+
+// UnmarshalTyped allocates a new instance of the type registered as typeName
+// and unmarshals data into it as UnmarshalX would, returning a pointer to the
+// instance. This suits decoding where the type is only chosen at runtime. An
+// error is returned if no type is registered under typeName.
+func UnmarshalTyped(data []byte, typeName string, opts *Options) (interface{}, error) {
+	registry.RLock()
+	t, ok := registry.types[typeName]
+	registry.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("json: no type registered as %q", typeName)
+	}
+
+	v := reflect.New(t).Interface()
+	if err := UnmarshalX(data, v, opts); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
@@ -0,0 +1,35 @@
+package json
+
+import "testing"
+
+func TestUnmarshalTyped(t *testing.T) {
+	RegisterType("test", TestStruct{})
+	RegisterType("test", &TestStruct{})
+
+	v, err := UnmarshalTyped([]byte(`{"foo": "a", "bar": 1}`), "test", &Options{Required: []string{"foo"}})
+	noErr(t, err)
+	o, ok := v.(*TestStruct)
+	if !ok {
+		t.Fatalf("got: %T, want: *TestStruct", v)
+	}
+	if o.Foo != "a" || o.Bar == nil || *o.Bar != 1 {
+		t.Errorf("got: %+v", o)
+	}
+
+	_, err = UnmarshalTyped([]byte(`{"bar": 1}`), "test", &Options{Required: []string{"foo"}})
+	testErrors(t, err, NewMissingKeyError("/foo"))
+
+	if _, err := UnmarshalTyped([]byte(`{}`), "missing", nil); err == nil {
+		t.Error("got: nil, want: error for an unregistered type")
+	}
+}
+
+func TestRegisterTypeConflict(t *testing.T) {
+	RegisterType("conflict", TestStruct{})
+	defer func() {
+		if recover() == nil {
+			t.Error("registering a second type under the same name didn't panic")
+		}
+	}()
+	RegisterType("conflict", strictStruct{})
+}
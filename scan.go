@@ -0,0 +1,273 @@
+package json
+
+import (
+	"encoding/json"
+	"sync"
+	"unicode/utf8"
+)
+
+// decodeObject decodes the top level of a json object into a map of its keys
+// to their raw values, as json.Unmarshal would into a
+// map[string]*json.RawMessage. Rather than copying each value the returned
+// RawMessages alias data. If intern is set key strings are shared between
+// calls through the package's intern table. The map is sized for sizeHint
+// keys.
+//
+// Input that is invalid, or that isn't an object, is handed to json.Unmarshal
+// so that the caller sees the same errors the standard library produces.
+func decodeObject(data []byte, intern bool, sizeHint int) (map[string]*json.RawMessage, error) {
+	if !isObject(data) {
+		dest := make(map[string]*json.RawMessage)
+		err := json.Unmarshal(data, &dest)
+		return dest, err
+	}
+
+	dest := make(map[string]*json.RawMessage, sizeHint)
+	err := scanObject(data, intern, func(key string, value []byte) {
+		if value[0] == 'n' {
+			dest[key] = nil
+		} else {
+			raw := json.RawMessage(value)
+			dest[key] = &raw
+		}
+	})
+	return dest, err
+}
+
+// presentValue stands in for every non-null value in the maps returned by
+// decodePresence.
+var presentValue = &json.RawMessage{}
+
+// decodePresence is as decodeObject but only records which keys are present:
+// null values are nil and every other value is presentValue. No values are
+// copied, which makes it much cheaper for objects holding large values.
+func decodePresence(data []byte, intern bool, sizeHint int) (map[string]*json.RawMessage, error) {
+	if !isObject(data) {
+		dest := make(map[string]*json.RawMessage)
+		err := json.Unmarshal(data, &dest)
+		return dest, err
+	}
+
+	dest := make(map[string]*json.RawMessage, sizeHint)
+	err := scanObject(data, intern, func(key string, value []byte) {
+		if value[0] == 'n' {
+			dest[key] = nil
+		} else {
+			dest[key] = presentValue
+		}
+	})
+	return dest, err
+}
+
+// objectKeys returns the keys of the top-level object in data in the order
+// they appear, including any duplicates.
+func objectKeys(data []byte) ([]string, error) {
+	if !isObject(data) {
+		return nil, json.Unmarshal(data, &map[string]*json.RawMessage{})
+	}
+
+	var keys []string
+	err := scanObject(data, false, func(key string, _ []byte) {
+		keys = append(keys, key)
+	})
+	return keys, err
+}
+
+// countItems returns the number of elements in the valid json array raw, or
+// limit+1 if there are more than limit of them. Elements are skipped over
+// rather than decoded.
+func countItems(raw []byte, limit int) int {
+	i := skipSpace(raw, skipSpace(raw, 0)+1)
+	n := 0
+	for raw[i] != ']' && n <= limit {
+		n++
+		i = skipSpace(raw, skipValue(raw, i))
+		if raw[i] == ',' {
+			i = skipSpace(raw, i+1)
+		}
+	}
+	return n
+}
+
+// validObject is as decodeObject for raw, an object within a document that
+// has already been checked by json.Valid, but doesn't check raw again. This
+// keeps walking nested values linear in their size rather than rescanning each
+// value once for every level that encloses it.
+func validObject(raw []byte) (map[string]*json.RawMessage, error) {
+	dest := make(map[string]*json.RawMessage)
+	err := scanObject(raw, false, func(key string, value []byte) {
+		if value[0] == 'n' {
+			dest[key] = nil
+		} else {
+			raw := json.RawMessage(value)
+			dest[key] = &raw
+		}
+	})
+	return dest, err
+}
+
+// validArray returns the elements of raw, an array within a document that has
+// already been checked by json.Valid, as json.Unmarshal would into a
+// []*json.RawMessage: null elements are nil and the rest alias raw.
+func validArray(raw []byte) []*json.RawMessage {
+	var elems []*json.RawMessage
+	i := skipSpace(raw, skipSpace(raw, 0)+1)
+	for raw[i] != ']' {
+		end := skipValue(raw, i)
+		if raw[i] == 'n' {
+			elems = append(elems, nil)
+		} else {
+			ele := json.RawMessage(raw[i:end:end])
+			elems = append(elems, &ele)
+		}
+		i = skipSpace(raw, end)
+		if raw[i] == ',' {
+			i = skipSpace(raw, i+1)
+		}
+	}
+	return elems
+}
+
+// isObject reports if data is valid json holding an object.
+func isObject(data []byte) bool {
+	i := skipSpace(data, 0)
+	return json.Valid(data) && i < len(data) && data[i] == '{'
+}
+
+// scanObject calls fn with each key of the top-level object in data, in
+// order, along with its raw value; data must satisfy isObject. The values
+// passed to fn alias data and have their capacity limited to their length.
+func scanObject(data []byte, intern bool, fn func(key string, value []byte)) error {
+	i := skipSpace(data, skipSpace(data, 0)+1)
+	for data[i] != '}' {
+		end := skipString(data, i)
+		key, err := objectKey(data[i:end], intern)
+		if err != nil {
+			return err
+		}
+
+		// skip the ':' separating the key from its value
+		i = skipSpace(data, skipSpace(data, end)+1)
+		end = skipValue(data, i)
+		fn(key, data[i:end:end])
+
+		i = skipSpace(data, end)
+		if data[i] == ',' {
+			i = skipSpace(data, i+1)
+		}
+	}
+	return nil
+}
+
+// objectKey returns the string value of the quoted key q. Keys holding
+// escapes or invalid utf-8 are unquoted by json.Unmarshal so that they match
+// what the standard library would produce.
+func objectKey(q []byte, intern bool) (string, error) {
+	unquoted := q[1 : len(q)-1]
+	ascii := true
+	for _, c := range unquoted {
+		if c == '\\' {
+			return unquoteKey(q)
+		}
+		ascii = ascii && c < utf8.RuneSelf
+	}
+	if !ascii && !utf8.Valid(unquoted) {
+		return unquoteKey(q)
+	}
+
+	if intern {
+		return internedKeys.intern(unquoted), nil
+	}
+	return string(unquoted), nil
+}
+
+func unquoteKey(q []byte) (string, error) {
+	var s string
+	err := json.Unmarshal(q, &s)
+	return s, err
+}
+
+// The following skip functions assume that data is valid json, as verified by
+// json.Valid, and return the index just past the skipped element.
+
+func skipSpace(data []byte, i int) int {
+	for i < len(data) {
+		switch data[i] {
+		case ' ', '\t', '\r', '\n':
+			i++
+		default:
+			return i
+		}
+	}
+	return i
+}
+
+func skipString(data []byte, i int) int {
+	for i++; data[i] != '"'; i++ {
+		if data[i] == '\\' {
+			i++
+		}
+	}
+	return i + 1
+}
+
+func skipValue(data []byte, i int) int {
+	switch data[i] {
+	case '"':
+		return skipString(data, i)
+	case '{', '[':
+		depth := 0
+		for ; ; i++ {
+			switch data[i] {
+			case '"':
+				i = skipString(data, i) - 1
+			case '{', '[':
+				depth++
+			case '}', ']':
+				depth--
+				if depth == 0 {
+					return i + 1
+				}
+			}
+		}
+	}
+
+	for i < len(data) {
+		switch data[i] {
+		case ',', '}', ']', ' ', '\t', '\r', '\n':
+			return i
+		}
+		i++
+	}
+	return i
+}
+
+// maxInternedKeys bounds the size of the intern table so that documents with
+// many distinct keys can't grow it without limit.
+const maxInternedKeys = 4096
+
+// internTable shares string instances for keys that are seen repeatedly.
+type internTable struct {
+	sync.RWMutex
+	m map[string]string
+}
+
+var internedKeys = internTable{m: map[string]string{}}
+
+// intern returns a shared string equal to b, adding one if there is room.
+func (t *internTable) intern(b []byte) string {
+	t.RLock()
+	s, ok := t.m[string(b)]
+	t.RUnlock()
+	if ok {
+		return s
+	}
+
+	s = string(b)
+	t.Lock()
+	if len(t.m) < maxInternedKeys {
+		t.m[s] = s
+	}
+	t.Unlock()
+	return s
+}
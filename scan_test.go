@@ -0,0 +1,295 @@
+package json
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"unsafe"
+)
+
+func TestDecodeObjectMatchesStdlib(t *testing.T) {
+	inputs := []string{
+		`{}`,
+		` { "foo" : "foo", "bar" : 4444 } `,
+		`{"a": null, "b": [1, {"c": "}"}], "d": {"e\"": "\\"}}`,
+		`{"escaped": 1, "dup": 1, "dup": 2}`,
+		`{"t": true, "f": false, "n": -1.5e3}`,
+		"{\"caf\u00e9\": 1, \"\xff\": 2}",
+	}
+
+	for _, in := range inputs {
+		want := make(map[string]*json.RawMessage)
+		if err := json.Unmarshal([]byte(in), &want); err != nil {
+			t.Fatalf("%s: %v", in, err)
+		}
+
+		for _, intern := range []bool{false, true} {
+			got, err := decodeObject([]byte(in), intern, 0)
+			noErr(t, err)
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("%s: got: %v, want: %v", in, got, want)
+			}
+		}
+	}
+}
+
+func TestDecodeObjectErrors(t *testing.T) {
+	for _, in := range []string{``, `{"foo": }`, `[1, 2]`, `"foo"`} {
+		want := json.Unmarshal([]byte(in), &map[string]*json.RawMessage{})
+		_, got := decodeObject([]byte(in), true, 0)
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: got: %#v, want: %#v", in, got, want)
+		}
+	}
+}
+
+func TestUnmarshalXInternKeys(t *testing.T) {
+	o := TestStruct{}
+	cfg := &Options{InternKeys: true, Required: []string{"foo"}, NullNotPresent: []string{"foo"}}
+	noErr(t, UnmarshalX(tsEncoded, &o, cfg))
+	testTS(t, o, ts)
+
+	e := UnmarshalX([]byte(`{"foo": null}`), &o, cfg)
+	testErrors(t, e, ValidationError{Type: MissingKey, Key: "foo", Path: "/foo", PathSegments: []string{"foo"}})
+}
+
+func TestInternTableSharesStrings(t *testing.T) {
+	a := internedKeys.intern([]byte("interned"))
+	b := internedKeys.intern([]byte("interned"))
+	if a != b || unsafe.StringData(a) != unsafe.StringData(b) {
+		t.Errorf("got distinct strings for the same key")
+	}
+}
+
+// objectWithKeys returns an object with n distinct keys and small values.
+func objectWithKeys(n int) []byte {
+	fields := make([]string, n)
+	for i := range fields {
+		fields[i] = fmt.Sprintf(`"key_number_%d": %d`, i, i)
+	}
+	return []byte("{" + strings.Join(fields, ",") + "}")
+}
+
+var manyKeys, hugeObject = objectWithKeys(100), objectWithKeys(10000)
+
+func benchmarkUnmarshalX(b *testing.B, data []byte, cfg *Options) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		var o struct{}
+		if err := UnmarshalX(data, &o, cfg); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkUnmarshalX(b *testing.B) {
+	benchmarkUnmarshalX(b, manyKeys, &Options{Required: []string{"key_number_1"}})
+}
+
+func benchmarkUnmarshalXMap(b *testing.B, data []byte, cfg *Options) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		var o map[string]interface{}
+		if err := UnmarshalX(data, &o, cfg); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkUnmarshalXMapDest(b *testing.B) {
+	// no option depends on the destination, so it isn't reflected over
+	benchmarkUnmarshalXMap(b, manyKeys, &Options{Required: []string{"key_number_1"}})
+}
+
+func BenchmarkUnmarshalXMapDestReflect(b *testing.B) {
+	// ReportUnknownKeys has the destination's fields looked up by reflection
+	benchmarkUnmarshalXMap(b, manyKeys, &Options{Required: []string{"key_number_1"}, ReportUnknownKeys: true})
+}
+
+func BenchmarkUnmarshalXInternKeys(b *testing.B) {
+	benchmarkUnmarshalX(b, manyKeys, &Options{InternKeys: true, Required: []string{"key_number_1"}})
+}
+
+func BenchmarkUnmarshalXLargeObject(b *testing.B) {
+	benchmarkUnmarshalX(b, hugeObject, &Options{Required: []string{"key_number_1"}})
+}
+
+func BenchmarkUnmarshalXLargeObjectExpectedKeys(b *testing.B) {
+	benchmarkUnmarshalX(b, hugeObject, &Options{ExpectedKeys: 10000, Required: []string{"key_number_1"}})
+}
+
+func TestUnmarshalXExpectedKeys(t *testing.T) {
+	for _, intern := range []bool{false, true} {
+		var o map[string]int
+		cfg := &Options{ExpectedKeys: 100, InternKeys: intern, Required: []string{"key_number_99"}}
+		noErr(t, UnmarshalX(manyKeys, &o, cfg))
+		if len(o) != 100 || o["key_number_99"] != 99 {
+			t.Errorf("got: %v, want: 100 keys", o)
+		}
+	}
+}
+
+func TestObjectKeys(t *testing.T) {
+	got, err := objectKeys([]byte(`{"b": {"x": 1}, "a": [], "c": 3, "b": 4}`))
+	noErr(t, err)
+	if want := []string{"b", "a", "c", "b"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got: %v, want: %v", got, want)
+	}
+
+	if _, err := objectKeys([]byte(`[1]`)); err == nil {
+		t.Errorf("got: nil, want: error")
+	}
+}
+
+func TestDecodePresence(t *testing.T) {
+	got, err := decodePresence([]byte(`{"a": {"big": [1, 2]}, "b": null, "c": "x"}`), false, 0)
+	noErr(t, err)
+	want := map[string]*json.RawMessage{"a": presentValue, "b": nil, "c": presentValue}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got: %v, want: %v", got, want)
+	}
+
+	if _, err := decodePresence([]byte(`[1]`), false, 0); err == nil {
+		t.Error("got: nil, want: error for an array")
+	}
+}
+
+func TestUnmarshalXPresenceOnly(t *testing.T) {
+	if !presenceOnly(Options{Required: []string{"foo"}, Forbidden: []string{"bar"}, FailFast: true}) {
+		t.Error("Required and Forbidden should be presence only")
+	}
+	for _, o := range []Options{
+		{Required: []string{"server.host"}},
+		{Required: []string{"foo"}, StripNulls: true},
+		{Forbidden: []string{"bar"}, CaptureForbiddenValues: true},
+	} {
+		if presenceOnly(o) {
+			t.Errorf("%+v shouldn't be presence only", o)
+		}
+	}
+
+	cfg := &Options{Required: []string{"foo", "baz"}, Forbidden: []string{"bar"}, NullNotPresent: []string{"baz"}}
+	var o TestStruct
+	e := UnmarshalX([]byte(`{"bar": 1, "baz": null}`), &o, cfg)
+	testErrors(t, e, NewMissingKeyError("/foo"), NewMissingKeyError("/baz"), NewForbiddenKeyError("/bar"))
+
+	noErr(t, UnmarshalX([]byte(`{"foo": "a", "baz": 2}`), &o, cfg))
+	if o.Foo != "a" {
+		t.Errorf("got: %q, want: a", o.Foo)
+	}
+}
+
+// largeValues is an object with a handful of keys holding large values.
+var largeValues = []byte(`{"id": 1, "blob": "` + strings.Repeat("x", 1<<20) + `", "list": [` +
+	strings.TrimSuffix(strings.Repeat("12345,", 1<<16), ",") + `]}`)
+
+func BenchmarkUnmarshalXLargeValues(b *testing.B) {
+	benchmarkUnmarshalX(b, largeValues, &Options{Required: []string{"id"}, Forbidden: []string{"secret"}})
+}
+
+func BenchmarkUnmarshalXLargeValuesFullDecode(b *testing.B) {
+	// any KeyPattern rules out the presence only decode
+	benchmarkUnmarshalX(b, largeValues, &Options{Required: []string{"id"}, Forbidden: []string{"secret"}, KeyPattern: "."})
+}
+
+// multiMB is a document of several megabytes with many keys of varied values.
+var multiMB = func() []byte {
+	fields := make([]string, 20000)
+	for i := range fields {
+		fields[i] = fmt.Sprintf(`"key_%d": {"name": "item %d", "tags": ["a", "b", "c"], "value": %d.5, "note": "%s"}`,
+			i, i, i, strings.Repeat("n", 100))
+	}
+	return []byte("{" + strings.Join(fields, ",") + "}")
+}()
+
+func BenchmarkUnmarshalXMultiMB(b *testing.B) {
+	b.SetBytes(int64(len(multiMB)))
+	benchmarkUnmarshalX(b, multiMB, &Options{Required: []string{"key_1"}, KeyPattern: "^key_"})
+}
+
+func BenchmarkStdlibUnmarshalMultiMB(b *testing.B) {
+	b.SetBytes(int64(len(multiMB)))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		var o struct{}
+		if err := json.Unmarshal(multiMB, &o); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestCountItems(t *testing.T) {
+	for _, tc := range []struct {
+		in    string
+		limit int
+		want  int
+	}{
+		{`[]`, 3, 0},
+		{` [ ] `, 3, 0},
+		{`[1, "a,]", {"b": [2, 3]}, [4]]`, 10, 4},
+		{`[1,2,3,4,5,6]`, 2, 3},
+	} {
+		if got := countItems([]byte(tc.in), tc.limit); got != tc.want {
+			t.Errorf("%s: got: %d, want: %d", tc.in, got, tc.want)
+		}
+	}
+}
+
+func TestValidObjectAndArrayMatchStdlib(t *testing.T) {
+	for _, in := range []string{`{}`, ` { "a" : [1, {"b": "}"}], "c": null, "d\"": 2, "d\"": 3 } `} {
+		want := make(map[string]*json.RawMessage)
+		noErr(t, json.Unmarshal([]byte(in), &want))
+		got, err := validObject([]byte(in))
+		noErr(t, err)
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: got: %v, want: %v", in, got, want)
+		}
+	}
+
+	for _, in := range []string{`[]`, ` [ ] `, `[1, null, "a,]", {"b": [2, 3]}, [4] ]`} {
+		var want []*json.RawMessage
+		noErr(t, json.Unmarshal([]byte(in), &want))
+		if len(want) == 0 {
+			want = nil
+		}
+		if got := validArray([]byte(in)); !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: got: %v, want: %v", in, got, want)
+		}
+	}
+}
+
+// deeplyNested holds arrays nested several thousand deep under "a".
+var deeplyNested = []byte(`{"a": ` + strings.Repeat("[", 5000) + strings.Repeat("]", 5000) + `}`)
+
+func BenchmarkUnmarshalXDeeplyNested(b *testing.B) {
+	b.SetBytes(int64(len(deeplyNested)))
+	benchmarkUnmarshalX(b, deeplyNested, &Options{MaxItemsDeep: 5})
+}
+
+// hugeArray holds an array of a million numbers under "items".
+var hugeArray = []byte(`{"items": [` + strings.Repeat("1234567,", 1<<20-1) + `1234567]}`)
+
+func BenchmarkUnmarshalXMaxItemsBeforeDecode(b *testing.B) {
+	cfg := &Options{MaxItemsBeforeDecode: map[string]int{"items": 100}}
+	b.SetBytes(int64(len(hugeArray)))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		var o struct{ Items []int }
+		if _, ok := UnmarshalX(hugeArray, &o, cfg).(ErrorCollection); !ok {
+			b.Fatal("want an ErrorCollection")
+		}
+	}
+}
+
+func BenchmarkStdlibUnmarshalHugeArray(b *testing.B) {
+	b.SetBytes(int64(len(hugeArray)))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		var o struct{ Items []int }
+		if err := json.Unmarshal(hugeArray, &o); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,136 @@
+package json
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// DecodeArray reads a top-level json array from r one element at a time so
+// that large arrays needn't be held in memory. Each element is validated
+// against opts and decoded into a fresh value from newElem, which is then
+// passed to yield along with any error from doing so. Decoding stops as soon
+// as yield returns false.
+//
+// If r doesn't hold a well formed array yield is called with a nil element
+// and the error encountered, after which decoding stops.
+func DecodeArray(r io.Reader, newElem func() interface{}, opts *Options, yield func(interface{}, error) bool) {
+	dec := json.NewDecoder(r)
+
+	tok, err := dec.Token()
+	if err != nil {
+		yield(nil, err)
+		return
+	}
+	if tok != json.Delim('[') {
+		yield(nil, fmt.Errorf("json: expected an array but found %v", tok))
+		return
+	}
+
+	for dec.More() {
+		var raw json.RawMessage
+		if err := dec.Decode(&raw); err != nil {
+			yield(nil, err)
+			return
+		}
+
+		elem := newElem()
+		if !yield(elem, UnmarshalX(raw, elem, opts)) {
+			return
+		}
+	}
+
+	if _, err := dec.Token(); err != nil {
+		yield(nil, err)
+	}
+}
+
+// Decoder reads successive json values from a stream, such as newline
+// delimited json, validating each against its Options as UnmarshalX would. It
+// wraps a json.Decoder and can stand in for one.
+type Decoder struct {
+	dec  *json.Decoder
+	opts *Options
+
+	useNumber             bool
+	disallowUnknownFields bool
+}
+
+// NewDecoder returns a Decoder reading from r which validates each value
+// against opts. A nil opts applies no validation.
+func NewDecoder(r io.Reader, opts *Options) *Decoder {
+	return &Decoder{dec: json.NewDecoder(r), opts: opts}
+}
+
+// Decode reads the next json value from the stream, validates it, and stores
+// it in v. Validation failures are returned as an ErrorCollection, after which
+// the stream is positioned at the following value so decoding may continue.
+// At the end of the stream io.EOF is returned.
+func (d *Decoder) Decode(v interface{}) error {
+	var raw json.RawMessage
+	if err := d.dec.Decode(&raw); err != nil {
+		return err
+	}
+	return UnmarshalX(raw, v, d.options())
+}
+
+// UseNumber causes every later Decode to unmarshal numbers into an
+// interface{} as json.Number rather than float64, as json.Decoder.UseNumber
+// does. It has no effect if the Options set Decode.
+func (d *Decoder) UseNumber() {
+	d.useNumber = true
+}
+
+// DisallowUnknownFields causes every later Decode to reject keys which don't
+// match a field of the destination, as if the Options set
+// DisallowUnknownFields.
+func (d *Decoder) DisallowUnknownFields() {
+	d.disallowUnknownFields = true
+}
+
+// options returns the Options each value is validated against: those d was
+// created with, updated by UseNumber and DisallowUnknownFields.
+func (d *Decoder) options() *Options {
+	if !d.useNumber && !d.disallowUnknownFields {
+		return d.opts
+	}
+
+	var o Options
+	if d.opts != nil {
+		o = *d.opts
+	}
+	if d.disallowUnknownFields {
+		o.DisallowUnknownFields = true
+	}
+	if d.useNumber && o.Decode == nil {
+		o.Decode = decodeUseNumber
+	}
+	return &o
+}
+
+// decodeUseNumber decodes data into v as json.Unmarshal would, but with
+// numbers decoded into an interface{} as json.Number.
+func decodeUseNumber(data []byte, v interface{}) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	return dec.Decode(v)
+}
+
+// Buffered returns a reader of the data remaining in the Decoder's buffer, as
+// json.Decoder.Buffered does.
+func (d *Decoder) Buffered() io.Reader {
+	return d.dec.Buffered()
+}
+
+// Token returns the next json token in the stream, as json.Decoder.Token does.
+// Tokens read this way are not validated.
+func (d *Decoder) Token() (json.Token, error) {
+	return d.dec.Token()
+}
+
+// More reports if there is another element in the current array or object
+// being parsed, as json.Decoder.More does.
+func (d *Decoder) More() bool {
+	return d.dec.More()
+}
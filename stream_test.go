@@ -0,0 +1,134 @@
+package json
+
+import (
+	"encoding/json"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestDecodeArray(t *testing.T) {
+	input := `[{"foo": "a"}, {"bar": 1}, {"foo": "c"}]`
+	cfg := &Options{Required: []string{"foo"}}
+
+	var got []string
+	var errs []error
+	DecodeArray(strings.NewReader(input), func() interface{} { return &TestStruct{} }, cfg,
+		func(v interface{}, err error) bool {
+			got = append(got, v.(*TestStruct).Foo)
+			errs = append(errs, err)
+			return true
+		})
+
+	if len(got) != 3 || got[0] != "a" || got[2] != "c" {
+		t.Errorf("got: %v, want: [a  c]", got)
+	}
+	if len(errs) != 3 {
+		t.Fatalf("got: %d errors, want: 3", len(errs))
+	}
+	noErr(t, errs[0])
+	testErrors(t, errs[1], ValidationError{Type: MissingKey, Key: "foo", Path: "/foo", PathSegments: []string{"foo"}})
+	noErr(t, errs[2])
+}
+
+func TestDecodeArrayStopsEarly(t *testing.T) {
+	input := `[{"foo": "a"}, {"bar": 1}, {"foo": "c"}]`
+	cfg := &Options{Required: []string{"foo"}}
+
+	calls := 0
+	DecodeArray(strings.NewReader(input), func() interface{} { return &TestStruct{} }, cfg,
+		func(v interface{}, err error) bool {
+			calls++
+			return err == nil
+		})
+
+	if calls != 2 {
+		t.Errorf("got: %d calls, want: 2", calls)
+	}
+}
+
+func TestDecodeArrayNotAnArray(t *testing.T) {
+	var errs []error
+	DecodeArray(strings.NewReader(`{"foo": "a"}`), func() interface{} { return &TestStruct{} }, nil,
+		func(v interface{}, err error) bool {
+			if v != nil {
+				t.Errorf("got: %#v, want: nil", v)
+			}
+			errs = append(errs, err)
+			return true
+		})
+
+	if len(errs) != 1 || errs[0] == nil {
+		t.Errorf("got: %v, want: a single error", errs)
+	}
+}
+
+func TestDecoder(t *testing.T) {
+	input := "{\"foo\": \"a\"}\n{\"bar\": 1}\n{\"foo\": \"c\"}\n"
+	dec := NewDecoder(strings.NewReader(input), &Options{Required: []string{"foo"}})
+
+	var o TestStruct
+	noErr(t, dec.Decode(&o))
+	if o.Foo != "a" {
+		t.Errorf("got: %q, want: a", o.Foo)
+	}
+
+	testErrors(t, dec.Decode(&TestStruct{}), NewMissingKeyError("/foo"))
+
+	o = TestStruct{}
+	noErr(t, dec.Decode(&o))
+	if o.Foo != "c" {
+		t.Errorf("got: %q, want: c", o.Foo)
+	}
+
+	if err := dec.Decode(&o); err != io.EOF {
+		t.Errorf("got: %v, want: io.EOF", err)
+	}
+}
+
+func TestDecoderTokens(t *testing.T) {
+	dec := NewDecoder(strings.NewReader(`[{"foo": "a"}, {"foo": "b"}] tail`), &Options{Required: []string{"foo"}})
+
+	if tok, err := dec.Token(); err != nil || tok != json.Delim('[') {
+		t.Fatalf("got: %v, %v, want: [", tok, err)
+	}
+	var got []string
+	for dec.More() {
+		var o TestStruct
+		noErr(t, dec.Decode(&o))
+		got = append(got, o.Foo)
+	}
+	if len(got) != 2 || got[0] != "a" || got[1] != "b" {
+		t.Errorf("got: %v, want: [a b]", got)
+	}
+	if tok, err := dec.Token(); err != nil || tok != json.Delim(']') {
+		t.Fatalf("got: %v, %v, want: ]", tok, err)
+	}
+
+	rest, _ := io.ReadAll(dec.Buffered())
+	if string(rest) != " tail" {
+		t.Errorf("got: %q, want: %q", rest, " tail")
+	}
+}
+
+func TestDecoderSettings(t *testing.T) {
+	input := "{\"n\": 1}\n{\"n\": 12345678901234567890}\n"
+	dec := NewDecoder(strings.NewReader(input), nil)
+	dec.UseNumber()
+
+	for _, want := range []string{"1", "12345678901234567890"} {
+		var o map[string]interface{}
+		noErr(t, dec.Decode(&o))
+		if n, ok := o["n"].(json.Number); !ok || n.String() != want {
+			t.Errorf("got: %#v, want: json.Number(%s)", o["n"], want)
+		}
+	}
+
+	input = "{\"foo\": \"a\", \"zed\": 1}\n{\"foo\": \"b\"}\n{\"zed\": 2}\n"
+	dec = NewDecoder(strings.NewReader(input), &Options{Required: []string{"foo"}})
+	dec.DisallowUnknownFields()
+
+	testErrors(t, dec.Decode(&TestStruct{}), NewValidationError(UnknownKey, "/zed", ""))
+	noErr(t, dec.Decode(&TestStruct{}))
+	testErrors(t, dec.Decode(&TestStruct{}), NewMissingKeyError("/foo"))
+}
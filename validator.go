@@ -0,0 +1,48 @@
+package json
+
+import "context"
+
+// Validator unmarshals documents against a fixed set of Options, which may
+// be overridden per request through the context passed to ValidateContext.
+// This suits services whose validation policy varies by tenant.
+type Validator struct {
+	opts *Options
+}
+
+// NewValidator returns a Validator applying opts.
+func NewValidator(opts *Options) *Validator {
+	return &Validator{opts: opts}
+}
+
+// Validate unmarshals data into v as UnmarshalX would with the Validator's
+// Options.
+func (val *Validator) Validate(data []byte, v interface{}) error {
+	return UnmarshalX(data, v, val.opts)
+}
+
+// ValidateContext behaves as Validate but uses the policy attached to ctx by
+// WithPolicy, if any, in place of the Validator's Options. If ctx is done
+// before validation completes its error is returned and v is left untouched.
+func (val *Validator) ValidateContext(ctx context.Context, data []byte, v interface{}) error {
+	opts := val.opts
+	if p, ok := PolicyFromContext(ctx); ok {
+		opts = p
+	}
+	_, err := unmarshalWithResult(ctx, data, v, opts)
+	return err
+}
+
+type policyKey struct{}
+
+// WithPolicy returns a copy of ctx carrying opts, which ValidateContext uses
+// in place of a Validator's own Options. The policy replaces them entirely
+// rather than being merged with them.
+func WithPolicy(ctx context.Context, opts *Options) context.Context {
+	return context.WithValue(ctx, policyKey{}, opts)
+}
+
+// PolicyFromContext returns the policy attached to ctx by WithPolicy.
+func PolicyFromContext(ctx context.Context) (*Options, bool) {
+	opts, ok := ctx.Value(policyKey{}).(*Options)
+	return opts, ok
+}
@@ -0,0 +1,36 @@
+package json
+
+import (
+	"context"
+	"testing"
+)
+
+func TestValidatorContextPolicy(t *testing.T) {
+	val := NewValidator(&Options{Required: []string{"foo"}})
+	input := []byte(`{"foo": "a", "bar": 1}`)
+
+	var o TestStruct
+	noErr(t, val.Validate(input, &o))
+	noErr(t, val.ValidateContext(context.Background(), input, &o))
+
+	strict := WithPolicy(context.Background(), &Options{Required: []string{"foo"}, Forbidden: []string{"bar"}})
+	testErrors(t, val.ValidateContext(strict, input, &o), NewForbiddenKeyError("/bar"))
+
+	if p, ok := PolicyFromContext(strict); !ok || len(p.Forbidden) != 1 {
+		t.Errorf("got: %v, %v, want the attached policy", p, ok)
+	}
+}
+
+func TestValidatorContextCancelled(t *testing.T) {
+	val := NewValidator(&Options{Required: []string{"foo"}})
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	o := TestStruct{Foo: "unchanged"}
+	if err := val.ValidateContext(ctx, []byte(`{"foo": "a"}`), &o); err != context.Canceled {
+		t.Errorf("got: %v, want: %v", err, context.Canceled)
+	}
+	if o.Foo != "unchanged" {
+		t.Errorf("got: %q, want the destination untouched", o.Foo)
+	}
+}